@@ -1,11 +1,14 @@
 package main
 
 import (
+	"log"
+	"os"
 	"time"
 
 	"github.com/FelippeTN/Web-Catalogo/backend/database"
 	"github.com/FelippeTN/Web-Catalogo/backend/handlers"
 	"github.com/FelippeTN/Web-Catalogo/backend/middleware"
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -13,6 +16,29 @@ import (
 
 func main() {
 	database.ConnectDatabase()
+	storage.ConnectStorage()
+
+	// One-off maintenance commands: ./main <command>
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backfill-images":
+			if err := handlers.BackfillImages(); err != nil {
+				log.Fatal("Backfill failed: ", err)
+			}
+		case "gc-uploads":
+			if err := handlers.CollectOrphanedUploads(); err != nil {
+				log.Fatal("Upload GC failed: ", err)
+			}
+		default:
+			log.Fatalf("Unknown command %q", os.Args[1])
+		}
+		return
+	}
+
+	handlers.StartTrashPurge(6 * time.Hour)
+	handlers.StartUploadGC(24 * time.Hour)
+	handlers.StartImageWorkers(handlers.ImageWorkers(), 2*time.Second)
+	handlers.StartImportJobRecovery(5 * time.Minute)
 
 	r := gin.Default()
 	r.SetTrustedProxies(nil)
@@ -37,7 +63,8 @@ func main() {
 		MaxAge:           12 * time.Hour,
 	}))
 
-	r.Static("/uploads", "./uploads")
+	r.GET("/uploads/*filepath", handlers.ServeUpload)
+	r.HEAD("/uploads/*filepath", handlers.ServeUpload)
 
 	publicRoutes := r.Group("/public")
 	{
@@ -48,6 +75,7 @@ func main() {
 		publicRoutes.POST("/register", middleware.RateLimitRegisterMiddleware(), handlers.Register)
 		publicRoutes.GET("/products", handlers.GetProducts)
 		publicRoutes.POST("/orders", handlers.CreateOrder)
+		publicRoutes.GET("/orders/:token", handlers.GetOrderByToken)
 		publicRoutes.GET("/collections", handlers.GetPublicCollections)
 		publicRoutes.GET("/catalogs/:token", handlers.GetPublicCatalogByToken)
 		publicRoutes.GET("/metadata/catalogs/:token", handlers.GetCatalogMetadata)
@@ -68,17 +96,56 @@ func main() {
 		protectedRoutes.PUT("/me/password", handlers.ChangePassword)
 		protectedRoutes.POST("/me/logo", handlers.UploadLogo)
 		protectedRoutes.DELETE("/me/logo", handlers.DeleteLogo)
+		protectedRoutes.PUT("/me/watermark", handlers.UpdateWatermark)
+		protectedRoutes.GET("/me/backup", handlers.ExportStore)
+		protectedRoutes.POST("/me/backup", handlers.RestoreStore)
 
 		protectedRoutes.POST("/collections", handlers.CreateCollection)
 		protectedRoutes.GET("/collections", handlers.GetMyCollections)
 		protectedRoutes.PUT("/collections/:id", handlers.UpdateCollection)
 		protectedRoutes.DELETE("/collections/:id", handlers.DeleteCollection)
 		protectedRoutes.POST("/collections/:id/share", handlers.ShareCollection)
+		protectedRoutes.DELETE("/collections/:id/share", handlers.UnshareCollection)
+		protectedRoutes.GET("/collections/:id/links", handlers.GetShareLinks)
+		protectedRoutes.POST("/collections/:id/links", handlers.CreateShareLink)
+		protectedRoutes.PUT("/collections/:id/links/:linkId", handlers.UpdateShareLink)
+		protectedRoutes.DELETE("/collections/:id/links/:linkId", handlers.DeleteShareLink)
+		protectedRoutes.POST("/collections/:id/links/:linkId/rotate", handlers.RotateShareLink)
+		protectedRoutes.POST("/collections/:id/duplicate", handlers.DuplicateCollection)
 
 		protectedRoutes.POST("/products", handlers.CreateProduct)
 		protectedRoutes.GET("/products", handlers.GetMyProducts)
+		protectedRoutes.GET("/products/lookup", handlers.LookupProduct)
 		protectedRoutes.PUT("/products/:id", handlers.UpdateProduct)
 		protectedRoutes.DELETE("/products/:id", handlers.DeleteProduct)
+		protectedRoutes.POST("/products/:id/duplicate", handlers.DuplicateProduct)
+		protectedRoutes.PUT("/products/:id/images/order", handlers.ReorderProductImages)
+		protectedRoutes.PUT("/products/:id/images/:imageId", handlers.UpdateProductImage)
+		protectedRoutes.PUT("/products/:id/images/:imageId/main", handlers.SetMainProductImage)
+		protectedRoutes.POST("/products/:id/images/:imageId/edit", handlers.EditProductImage)
+		protectedRoutes.GET("/products/:id/history", handlers.GetProductHistory)
+		protectedRoutes.POST("/products/:id/history/:revisionId/revert", handlers.RevertProduct)
+		protectedRoutes.POST("/products/bulk", handlers.BulkUpdateProducts)
+		protectedRoutes.POST("/products/import", handlers.ImportProducts)
+		protectedRoutes.GET("/products/import", handlers.GetMyImportJobs)
+		protectedRoutes.GET("/products/import/:id", handlers.GetImportJob)
+
+		protectedRoutes.GET("/orders", handlers.GetMyOrders)
+
+		protectedRoutes.GET("/trash", handlers.GetTrash)
+		protectedRoutes.POST("/trash/products/:id/restore", handlers.RestoreProduct)
+		protectedRoutes.POST("/trash/collections/:id/restore", handlers.RestoreCollection)
+
+		protectedRoutes.POST("/campaigns", handlers.CreateCampaign)
+		protectedRoutes.GET("/campaigns", handlers.GetMyCampaigns)
+		protectedRoutes.PUT("/campaigns/:id", handlers.UpdateCampaign)
+		protectedRoutes.DELETE("/campaigns/:id", handlers.DeleteCampaign)
+
+		protectedRoutes.POST("/attributes", handlers.CreateAttribute)
+		protectedRoutes.GET("/attributes", handlers.GetMyAttributes)
+		protectedRoutes.PUT("/attributes/:id", handlers.UpdateAttribute)
+		protectedRoutes.DELETE("/attributes/:id", handlers.DeleteAttribute)
+
 		protectedRoutes.POST("/create-checkout-session", handlers.CreateCheckoutSession)
 	}
 
@@ -1,10 +1,14 @@
 package config
 
 const (
-	MaxImageSize        = 10 * 1024 * 1024 // 10MB
-	MaxLogoSize         = 2 * 1024 * 1024  // 2MB
-	MaxImagesPerProduct = 3
-	MaxUsernameLength   = 50
-	MaxPasswordLength   = 128
-	JpegQuality         = 75
+	MaxImageSize      = 10 * 1024 * 1024 // 10MB
+	MaxLogoSize       = 2 * 1024 * 1024  // 2MB
+	MaxUsernameLength = 50
+	MaxPasswordLength = 128
+	JpegQuality       = 75
+	MaxImageDimension = 2560             // longest side in pixels; MAX_IMAGE_DIMENSION overrides it
+	MaxImagePixels    = 50 * 1000 * 1000 // 50 megapixels, checked before decoding
+
+	ImageWorkers        = 2 // images processed at once; IMAGE_WORKERS overrides it
+	ImageJobMaxAttempts = 3
 )
@@ -64,12 +64,25 @@ func ConnectDatabase() {
 		log.Fatal("Failed to migrate User table!", err)
 	}
 
+	// Columns added since the last start, filled in below for existing rows
+	backfillItemSnapshots := !database.Migrator().HasColumn(&models.OrderItem{}, "product_name")
+	backfillItemOwners := !database.Migrator().HasColumn(&models.OrderItem{}, "owner_id")
+	countImageFiles := !database.Migrator().HasTable(&models.ImageFile{})
+
 	err = database.AutoMigrate(
 		&models.Collection{},
 		&models.Product{},
 		&models.ProductImage{},
+		&models.ImageFile{},
+		&models.ImageJob{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.Campaign{},
+		&models.ShareLink{},
+		&models.ImportJob{},
+		&models.ProductRevision{},
+		&models.AttributeDefinition{},
+		&models.ProductAttributeValue{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database!", err)
@@ -81,6 +94,39 @@ func ConnectDatabase() {
 	database.Exec(`ALTER TABLE order_items ADD CONSTRAINT fk_order_items_product 
 		FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE SET NULL`)
 
+	// Backfill snapshots and stores of items ordered before they were recorded
+	if backfillItemSnapshots {
+		database.Exec(`UPDATE order_items SET product_name = p.name, image_url = COALESCE(p.image_url, '')
+			FROM products p WHERE order_items.product_id = p.id AND order_items.product_name = ''`)
+	}
+	if backfillItemOwners {
+		database.Exec(`UPDATE order_items SET owner_id = p.owner_id
+			FROM products p WHERE order_items.product_id = p.id AND order_items.owner_id IS NULL`)
+	}
+
+	// Count the references to image files of images uploaded before files
+	// were shared. Files no image uses have no row, like after a release.
+	if countImageFiles {
+		database.Exec(`INSERT INTO image_files (url, ref_count, created_at, updated_at)
+			SELECT image_url, COUNT(*), NOW(), NOW() FROM product_images GROUP BY image_url
+			ON CONFLICT (url) DO UPDATE SET ref_count = EXCLUDED.ref_count`)
+		database.Exec(`DELETE FROM image_files WHERE url NOT IN (SELECT image_url FROM product_images)`)
+	}
+
+	// Move the single share token collections used to have to a share link
+	if database.Migrator().HasColumn(&models.Collection{}, "share_token") {
+		err = database.Exec(`INSERT INTO share_links (owner_id, collection_id, name, token, is_active, created_at, updated_at)
+			SELECT owner_id, id, 'Link', share_token, true, NOW(), NOW() FROM collections
+			WHERE share_token IS NOT NULL AND share_token <> ''
+			ON CONFLICT (token) DO NOTHING`).Error
+		if err == nil {
+			err = database.Migrator().DropColumn(&models.Collection{}, "share_token")
+		}
+		if err != nil {
+			log.Printf("Failed to migrate share tokens: %v", err)
+		}
+	}
+
 	DB = database
 }
 
@@ -112,6 +158,8 @@ func seedPlans(db *gorm.DB) {
 			existing.StripePriceID = plan.StripePriceID
 			existing.MaxProducts = plan.MaxProducts
 			existing.MaxCollections = plan.MaxCollections
+			existing.MaxStorageBytes = plan.MaxStorageBytes
+			existing.MaxImagesPerProduct = plan.MaxImagesPerProduct
 			existing.Features = plan.Features
 			existing.IsActive = plan.IsActive
 			if err := db.Save(&existing).Error; err != nil {
@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxAttributeTextLength = 500
+
+var attributeKeyRegex = regexp.MustCompile(`^[a-z0-9_]{1,50}$`)
+
+var (
+	errOptionsInUse        = errors.New("Options still in use by products")
+	errAttributeOptionGone = errors.New("attribute options changed, please review the values")
+)
+
+func CreateAttribute(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input models.CreateAttributeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	key := strings.ToLower(strings.TrimSpace(input.Key))
+	if !attributeKeyRegex.MatchString(key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key. Use lowercase letters, numbers and underscores"})
+		return
+	}
+	if !models.IsValidAttributeType(input.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type"})
+		return
+	}
+	options := normalizeSizes(input.Options)
+	if input.Type == models.AttributeTypeSelect && options == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Select attributes need options"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.AttributeDefinition{}).Where("owner_id = ? AND key = ?", ownerID, key).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attribute key already exists"})
+		return
+	}
+
+	attribute := models.AttributeDefinition{
+		OwnerID:  ownerID,
+		Key:      key,
+		Label:    strings.TrimSpace(input.Label),
+		Type:     input.Type,
+		Options:  options,
+		Required: input.Required,
+		Position: input.Position,
+	}
+
+	if err := database.DB.Create(&attribute).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create attribute"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, attribute)
+}
+
+func GetMyAttributes(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var attributes []models.AttributeDefinition
+	if err := database.DB.Where("owner_id = ?", ownerID).Order("position asc, id asc").Find(&attributes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve attributes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, attributes)
+}
+
+// UpdateAttribute changes how an attribute is presented and validated. Key
+// and type are fixed once created so stored values stay meaningful.
+func UpdateAttribute(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var input models.UpdateAttributeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	var attribute models.AttributeDefinition
+	if err := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&attribute).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attribute not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve attribute"})
+		return
+	}
+
+	updates := map[string]any{}
+	if input.Label != nil {
+		attribute.Label = strings.TrimSpace(*input.Label)
+		updates["label"] = attribute.Label
+	}
+	if input.Options != nil {
+		attribute.Options = normalizeSizes(*input.Options)
+		if attribute.Type == models.AttributeTypeSelect && attribute.Options == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Select attributes need options"})
+			return
+		}
+		updates["options"] = attribute.Options
+	}
+	if input.Required != nil {
+		attribute.Required = *input.Required
+		updates["required"] = attribute.Required
+	}
+	if input.Position != nil {
+		attribute.Position = *input.Position
+		updates["position"] = attribute.Position
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	var inUse []string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		_, optionsChanged := updates["options"]
+		optionsChanged = optionsChanged && attribute.Type == models.AttributeTypeSelect
+		if optionsChanged {
+			// Products saved meanwhile wait on this lock, see saveAttributeValues
+			var locked models.AttributeDefinition
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, attribute.ID).Error; err != nil {
+				return err
+			}
+			var err error
+			if inUse, err = valuesOutsideOptions(tx, attribute); err != nil {
+				return err
+			}
+			if len(inUse) > 0 {
+				return errOptionsInUse
+			}
+		}
+		if err := tx.Model(&attribute).Updates(updates).Error; err != nil {
+			return err
+		}
+		if !optionsChanged {
+			return nil
+		}
+		// Values follow the new spelling of options that only changed case.
+		for _, option := range strings.Split(attribute.Options, ",") {
+			if err := tx.Model(&models.ProductAttributeValue{}).
+				Where("attribute_id = ? AND LOWER(value) = LOWER(?) AND value <> ?", attribute.ID, option, option).
+				Update("value", option).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errOptionsInUse) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "values": inUse})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update attribute"})
+		return
+	}
+
+	c.JSON(http.StatusOK, attribute)
+}
+
+func DeleteAttribute(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var attribute models.AttributeDefinition
+		if err := tx.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&attribute).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("attribute_id = ?", attribute.ID).Delete(&models.ProductAttributeValue{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&attribute).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attribute not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete attribute"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// parseAttributeValues validates a JSON object of attribute key -> value
+// against the owner's definitions. The result maps attribute IDs to their
+// canonical value; an empty value means the attribute should be removed.
+// With requireAll, every required attribute must be present.
+func parseAttributeValues(ownerID uint, raw string, requireAll bool) (map[uint]string, error) {
+	values := map[string]any{}
+	if strings.TrimSpace(raw) != "" {
+		if err := json.Unmarshal([]byte(raw), &values); err != nil {
+			return nil, errors.New("attributes must be a JSON object")
+		}
+	}
+
+	var definitions []models.AttributeDefinition
+	if err := database.DB.Where("owner_id = ?", ownerID).Find(&definitions).Error; err != nil {
+		return nil, errors.New("could not load attributes")
+	}
+	byKey := map[string]models.AttributeDefinition{}
+	for _, definition := range definitions {
+		byKey[definition.Key] = definition
+	}
+
+	result := map[uint]string{}
+	for key, value := range values {
+		definition, ok := byKey[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown attribute %q", key)
+		}
+		canonical, err := canonicalAttributeValue(definition, value)
+		if err != nil {
+			return nil, err
+		}
+		if canonical == "" && definition.Required {
+			return nil, fmt.Errorf("attribute %q is required", key)
+		}
+		result[definition.ID] = canonical
+	}
+
+	if requireAll {
+		for _, definition := range definitions {
+			if definition.Required && result[definition.ID] == "" {
+				return nil, fmt.Errorf("attribute %q is required", definition.Key)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func canonicalAttributeValue(definition models.AttributeDefinition, value any) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	if s, ok := value.(string); ok && strings.TrimSpace(s) == "" {
+		return "", nil
+	}
+
+	invalid := fmt.Errorf("invalid value for attribute %q", definition.Key)
+
+	switch definition.Type {
+	case models.AttributeTypeText:
+		s, ok := value.(string)
+		if !ok {
+			return "", invalid
+		}
+		s = strings.TrimSpace(s)
+		if len([]rune(s)) > maxAttributeTextLength {
+			return "", invalid
+		}
+		return s, nil
+
+	case models.AttributeTypeNumber:
+		switch v := value.(type) {
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case string:
+			f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(v), ",", "."), 64)
+			if err != nil {
+				return "", invalid
+			}
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
+		}
+		return "", invalid
+
+	case models.AttributeTypeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return strconv.FormatBool(v), nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return "", invalid
+			}
+			return strconv.FormatBool(b), nil
+		}
+		return "", invalid
+
+	case models.AttributeTypeSelect:
+		s, ok := value.(string)
+		if !ok {
+			return "", invalid
+		}
+		s = strings.TrimSpace(s)
+		for _, option := range strings.Split(definition.Options, ",") {
+			if strings.EqualFold(option, s) {
+				return option, nil
+			}
+		}
+		return "", invalid
+	}
+
+	return "", invalid
+}
+
+// valuesOutsideOptions returns the distinct values products hold for a select
+// attribute that its options no longer allow.
+func valuesOutsideOptions(tx *gorm.DB, attribute models.AttributeDefinition) ([]string, error) {
+	var values []string
+	if err := tx.Model(&models.ProductAttributeValue{}).
+		Where("attribute_id = ?", attribute.ID).
+		Distinct("value").Pluck("value", &values).Error; err != nil {
+		return nil, err
+	}
+
+	outside := []string{}
+	for _, value := range values {
+		if _, err := canonicalAttributeValue(attribute, value); err != nil {
+			outside = append(outside, value)
+		}
+	}
+	return outside, nil
+}
+
+// saveAttributeValues writes the parsed values of a product, removing the
+// attributes whose value is empty.
+func saveAttributeValues(tx *gorm.DB, productID uint, values map[uint]string) error {
+	if err := lockAttributeOptions(tx, values); err != nil {
+		return err
+	}
+	for attributeID, value := range values {
+		if err := tx.Where("product_id = ? AND attribute_id = ?", productID, attributeID).Delete(&models.ProductAttributeValue{}).Error; err != nil {
+			return err
+		}
+		if value == "" {
+			continue
+		}
+		row := models.ProductAttributeValue{ProductID: productID, AttributeID: attributeID, Value: value}
+		if err := tx.Create(&row).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockAttributeOptions share-locks the select definitions of values and
+// checks the values against their options, which UpdateAttribute may have
+// changed after they were parsed.
+func lockAttributeOptions(tx *gorm.DB, values map[uint]string) error {
+	var ids []uint
+	for attributeID, value := range values {
+		if value != "" {
+			ids = append(ids, attributeID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var definitions []models.AttributeDefinition
+	if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).
+		Where("id IN ? AND type = ?", ids, models.AttributeTypeSelect).
+		Find(&definitions).Error; err != nil {
+		return err
+	}
+	for _, definition := range definitions {
+		if _, err := canonicalAttributeValue(definition, values[definition.ID]); err != nil {
+			return errAttributeOptionGone
+		}
+	}
+	return nil
+}
+
+// filterByAttributes keeps products whose attributes match every key/value
+// pair (case-insensitively).
+func filterByAttributes(query *gorm.DB, filters map[string]string) *gorm.DB {
+	for key, value := range filters {
+		query = query.Where(`EXISTS (
+			SELECT 1 FROM product_attribute_values v
+			JOIN attribute_definitions d ON d.id = v.attribute_id
+			WHERE v.product_id = products.id AND d.key = ? AND LOWER(v.value) = LOWER(?))`, key, value)
+	}
+	return query
+}
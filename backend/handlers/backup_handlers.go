@@ -0,0 +1,688 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/config"
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
+	"github.com/FelippeTN/Web-Catalogo/backend/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	backupVersion    = 1
+	maxBackupZipSize = 500 * 1024 * 1024 // 500MB
+)
+
+// backupManifest is the manifest.json of a store backup archive. Records
+// reference each other through the Ref of the original collection, and
+// images through their path inside the archive.
+type backupManifest struct {
+	Version     int                `json:"version"`
+	ExportedAt  time.Time          `json:"exported_at"`
+	Store       backupStore        `json:"store"`
+	Collections []backupCollection `json:"collections"`
+	Products    []backupProduct    `json:"products"`
+	Campaigns   []backupCampaign   `json:"campaigns"`
+	Attributes  []backupAttribute  `json:"attributes"`
+}
+
+type backupStore struct {
+	Name  string `json:"name"`
+	Phone string `json:"phone"`
+	Logo  string `json:"logo,omitempty"`
+}
+
+type backupCollection struct {
+	Ref         uint   `json:"ref"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Visibility  string `json:"visibility,omitempty"`
+}
+
+type backupProduct struct {
+	CollectionRef  *uint             `json:"collection_ref"`
+	Name           string            `json:"name"`
+	Description    string            `json:"description"`
+	Price          float64           `json:"price"`
+	Sizes          string            `json:"sizes"`
+	Tags           string            `json:"tags"`
+	Stock          *int              `json:"stock"`
+	SKU            *string           `json:"sku"`
+	Barcode        *string           `json:"barcode"`
+	WeightGrams    *int              `json:"weight_grams"`
+	LengthCm       *float64          `json:"length_cm"`
+	WidthCm        *float64          `json:"width_cm"`
+	HeightCm       *float64          `json:"height_cm"`
+	Status         string            `json:"status"`
+	PublishAt      *time.Time        `json:"publish_at"`
+	UnpublishAt    *time.Time        `json:"unpublish_at"`
+	CompareAtPrice *float64          `json:"compare_at_price"`
+	SalePrice      *float64          `json:"sale_price"`
+	SaleStartsAt   *time.Time        `json:"sale_starts_at"`
+	SaleEndsAt     *time.Time        `json:"sale_ends_at"`
+	Images         []string          `json:"images"`
+	ImageAltTexts  []string          `json:"image_alt_texts,omitempty"` // parallel to Images
+	Attributes     map[string]string `json:"attributes,omitempty"`
+}
+
+type backupAttribute struct {
+	Key      string `json:"key"`
+	Label    string `json:"label"`
+	Type     string `json:"type"`
+	Options  string `json:"options"`
+	Required bool   `json:"required"`
+	Position int    `json:"position"`
+}
+
+type backupCampaign struct {
+	CollectionRef   *uint      `json:"collection_ref"`
+	Name            string     `json:"name"`
+	DiscountPercent float64    `json:"discount_percent"`
+	StartsAt        *time.Time `json:"starts_at"`
+	EndsAt          *time.Time `json:"ends_at"`
+	IsActive        bool       `json:"is_active"`
+}
+
+// ExportStore streams a ZIP with manifest.json, a products.csv compatible
+// with ImportProducts and every image file of the store.
+func ExportStore(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, ownerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var collections []models.Collection
+	if err := database.DB.Where("owner_id = ?", ownerID).Order("id asc").Find(&collections).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve collections"})
+		return
+	}
+
+	var products []models.Product
+	if err := database.DB.Preload("Images", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc")
+	}).Preload("Attributes.Attribute").Where("owner_id = ?", ownerID).Order("id asc").Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve products"})
+		return
+	}
+
+	var campaigns []models.Campaign
+	if err := database.DB.Where("owner_id = ?", ownerID).Order("id asc").Find(&campaigns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve campaigns"})
+		return
+	}
+
+	var attributes []models.AttributeDefinition
+	if err := database.DB.Where("owner_id = ?", ownerID).Order("position asc, id asc").Find(&attributes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve attributes"})
+		return
+	}
+
+	// archive path -> storage key
+	files := map[string]string{}
+	addFile := func(dir, imageURL string) string {
+		key, ok := storage.KeyFromURL(imageURL)
+		if !ok {
+			return ""
+		}
+		archivePath := dir + "/" + path.Base(imageURL)
+		files[archivePath] = key
+		return archivePath
+	}
+
+	manifest := backupManifest{
+		Version:    backupVersion,
+		ExportedAt: time.Now(),
+		Store:      backupStore{Name: user.Username, Phone: user.Number},
+	}
+	if user.LogoURL != "" {
+		manifest.Store.Logo = addFile("logo", user.LogoURL)
+	}
+
+	collectionNames := map[uint]string{}
+	for _, collection := range collections {
+		collectionNames[collection.ID] = collection.Name
+		manifest.Collections = append(manifest.Collections, backupCollection{
+			Ref:         collection.ID,
+			Name:        collection.Name,
+			Description: collection.Description,
+			Visibility:  collection.Visibility,
+		})
+	}
+
+	for _, product := range products {
+		entry := backupProduct{
+			CollectionRef:  product.CollectionID,
+			Name:           product.Name,
+			Description:    product.Description,
+			Price:          product.Price,
+			Sizes:          product.Sizes,
+			Tags:           product.Tags,
+			Stock:          product.Stock,
+			SKU:            product.SKU,
+			Barcode:        product.Barcode,
+			WeightGrams:    product.WeightGrams,
+			LengthCm:       product.LengthCm,
+			WidthCm:        product.WidthCm,
+			HeightCm:       product.HeightCm,
+			Status:         product.Status,
+			PublishAt:      product.PublishAt,
+			UnpublishAt:    product.UnpublishAt,
+			CompareAtPrice: product.CompareAtPrice,
+			SalePrice:      product.SalePrice,
+			SaleStartsAt:   product.SaleStartsAt,
+			SaleEndsAt:     product.SaleEndsAt,
+		}
+		for _, image := range product.Images {
+			if archivePath := addFile("images", image.ImageURL); archivePath != "" {
+				entry.Images = append(entry.Images, archivePath)
+				entry.ImageAltTexts = append(entry.ImageAltTexts, image.AltText)
+			}
+		}
+		for _, value := range product.Attributes {
+			if value.Attribute == nil {
+				continue
+			}
+			if entry.Attributes == nil {
+				entry.Attributes = map[string]string{}
+			}
+			entry.Attributes[value.Attribute.Key] = value.Value
+		}
+		manifest.Products = append(manifest.Products, entry)
+	}
+
+	for _, campaign := range campaigns {
+		manifest.Campaigns = append(manifest.Campaigns, backupCampaign{
+			CollectionRef:   campaign.CollectionID,
+			Name:            campaign.Name,
+			DiscountPercent: campaign.DiscountPercent,
+			StartsAt:        campaign.StartsAt,
+			EndsAt:          campaign.EndsAt,
+			IsActive:        campaign.IsActive,
+		})
+	}
+
+	for _, attribute := range attributes {
+		manifest.Attributes = append(manifest.Attributes, backupAttribute{
+			Key:      attribute.Key,
+			Label:    attribute.Label,
+			Type:     attribute.Type,
+			Options:  attribute.Options,
+			Required: attribute.Required,
+			Position: attribute.Position,
+		})
+	}
+
+	filename := fmt.Sprintf("vitrine-backup-%s.zip", time.Now().Format("2006-01-02"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	defer archive.Close()
+
+	manifestJSON, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := writeZipEntry(archive, "manifest.json", bytes.NewReader(manifestJSON)); err != nil {
+		log.Printf("Export for user %d failed: %v", ownerID, err)
+		return
+	}
+
+	if err := writeZipEntry(archive, "products.csv", bytes.NewReader(productsCSV(manifest.Products, collectionNames))); err != nil {
+		log.Printf("Export for user %d failed: %v", ownerID, err)
+		return
+	}
+
+	for archivePath, key := range files {
+		f, err := storage.Store.Get(key)
+		if err != nil {
+			log.Printf("Export for user %d: skipping missing file %s", ownerID, key)
+			continue
+		}
+		err = writeZipEntry(archive, archivePath, f)
+		f.Close()
+		if err != nil {
+			log.Printf("Export for user %d failed: %v", ownerID, err)
+			return
+		}
+	}
+}
+
+func writeZipEntry(archive *zip.Writer, name string, r io.Reader) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func productsCSV(products []backupProduct, collectionNames map[uint]string) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"name", "description", "price", "sizes", "tags", "collection", "stock", "sku", "barcode", "images"})
+	for _, product := range products {
+		collection := ""
+		if product.CollectionRef != nil {
+			collection = collectionNames[*product.CollectionRef]
+		}
+		stock := ""
+		if product.Stock != nil {
+			stock = strconv.Itoa(*product.Stock)
+		}
+		sku, barcode := "", ""
+		if product.SKU != nil {
+			sku = *product.SKU
+		}
+		if product.Barcode != nil {
+			barcode = *product.Barcode
+		}
+		var images []string
+		for _, image := range product.Images {
+			images = append(images, path.Base(image))
+		}
+		w.Write([]string{
+			product.Name,
+			product.Description,
+			strconv.FormatFloat(product.Price, 'f', 2, 64),
+			product.Sizes,
+			product.Tags,
+			collection,
+			stock,
+			sku,
+			barcode,
+			strings.Join(images, "|"),
+		})
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// RestoreStore recreates the collections, products, images and campaigns of
+// a backup archive under the authenticated account. Store name and phone are
+// left untouched since they identify the account.
+func RestoreStore(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Backup file not provided"})
+		return
+	}
+	if fileHeader.Size > maxBackupZipSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Backup file too large"})
+		return
+	}
+
+	archive, tmpPath, err := spoolZipFile(fileHeader, maxBackupZipSize, "backup-*.zip")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid backup file"})
+		return
+	}
+	defer os.Remove(tmpPath)
+	defer archive.Close()
+
+	files := map[string]*zip.File{}
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	manifestFile, ok := files["manifest.json"]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Backup file has no manifest"})
+		return
+	}
+	var manifest backupManifest
+	if err := decodeZipJSON(manifestFile, &manifest); err != nil || manifest.Version != backupVersion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid backup manifest"})
+		return
+	}
+
+	if !checkRestoreLimits(c, ownerID, &manifest) {
+		return
+	}
+
+	// Images are written before the transaction; if it fails they are left
+	// unreferenced on disk.
+	savedImages := map[string]string{}
+	for _, product := range manifest.Products {
+		for _, archivePath := range product.Images {
+			if _, done := savedImages[archivePath]; done {
+				continue
+			}
+			url, err := restoreImage(files, archivePath)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid image %s in backup", archivePath)})
+				return
+			}
+			savedImages[archivePath] = url
+		}
+	}
+
+	var logoURL string
+	var logoSize int64
+	if manifest.Store.Logo != "" {
+		if url, err := restoreLogo(files, manifest.Store.Logo, ownerID); err == nil {
+			logoURL = url
+			logoSize, _ = utils.UploadSize(url)
+		}
+	}
+
+	if !checkRestoreStorage(c, ownerID, savedImages, logoURL, logoSize) {
+		return
+	}
+
+	restoredImages := map[string]models.ProductImage{}
+	for archivePath, url := range savedImages {
+		restoredImages[archivePath] = newProductImages([]string{url})[0]
+	}
+
+	var createdCollections, createdProducts int
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		collectionIDs := map[uint]uint{}
+		for _, entry := range manifest.Collections {
+			collection := models.Collection{OwnerID: ownerID, Name: entry.Name, Description: entry.Description}
+			if models.IsValidCollectionVisibility(entry.Visibility) {
+				collection.Visibility = entry.Visibility
+			}
+			if err := tx.Create(&collection).Error; err != nil {
+				return err
+			}
+			collectionIDs[entry.Ref] = collection.ID
+			createdCollections++
+		}
+		// Attributes the account already has are reused by key.
+		attributes := map[string]models.AttributeDefinition{}
+		for _, entry := range manifest.Attributes {
+			if !attributeKeyRegex.MatchString(entry.Key) || !models.IsValidAttributeType(entry.Type) {
+				continue
+			}
+			attribute := models.AttributeDefinition{
+				OwnerID:  ownerID,
+				Key:      entry.Key,
+				Label:    entry.Label,
+				Type:     entry.Type,
+				Options:  normalizeSizes(entry.Options),
+				Required: entry.Required,
+				Position: entry.Position,
+			}
+			if err := tx.Where("owner_id = ? AND key = ?", ownerID, entry.Key).FirstOrCreate(&attribute).Error; err != nil {
+				return err
+			}
+			attributes[entry.Key] = attribute
+		}
+
+		mapRef := func(ref *uint) *uint {
+			if ref == nil {
+				return nil
+			}
+			if id, ok := collectionIDs[*ref]; ok {
+				return &id
+			}
+			return nil
+		}
+
+		for _, entry := range manifest.Products {
+			status := entry.Status
+			if !models.IsValidProductStatus(status) {
+				status = models.ProductStatusPublished
+			}
+			product := models.Product{
+				OwnerID:        ownerID,
+				CollectionID:   mapRef(entry.CollectionRef),
+				Name:           entry.Name,
+				Description:    entry.Description,
+				Price:          entry.Price,
+				Sizes:          entry.Sizes,
+				Tags:           entry.Tags,
+				Stock:          entry.Stock,
+				SKU:            normalizeCode(entry.SKU),
+				Barcode:        normalizeCode(entry.Barcode),
+				WeightGrams:    entry.WeightGrams,
+				LengthCm:       entry.LengthCm,
+				WidthCm:        entry.WidthCm,
+				HeightCm:       entry.HeightCm,
+				Status:         status,
+				PublishAt:      entry.PublishAt,
+				UnpublishAt:    entry.UnpublishAt,
+				CompareAtPrice: entry.CompareAtPrice,
+				SalePrice:      entry.SalePrice,
+				SaleStartsAt:   entry.SaleStartsAt,
+				SaleEndsAt:     entry.SaleEndsAt,
+			}
+			if product.SKU != nil {
+				taken, err := skuInUse(tx, ownerID, *product.SKU, 0)
+				if err != nil {
+					return err
+				}
+				if taken {
+					product.SKU = nil
+				}
+			}
+			if product.Barcode != nil && !utils.IsValidGTIN(*product.Barcode) {
+				product.Barcode = nil
+			}
+			if len(entry.Images) > 0 {
+				mainImage := savedImages[entry.Images[0]]
+				product.ImageURL = &mainImage
+			}
+			if err := tx.Create(&product).Error; err != nil {
+				return err
+			}
+			images := make([]models.ProductImage, len(entry.Images))
+			for i, archivePath := range entry.Images {
+				images[i] = restoredImages[archivePath]
+				images[i].Position = i
+				if i < len(entry.ImageAltTexts) {
+					images[i].AltText = entry.ImageAltTexts[i]
+				}
+			}
+			if err := createProductImages(tx, product.ID, images); err != nil {
+				return err
+			}
+			for key, value := range entry.Attributes {
+				attribute, ok := attributes[key]
+				if !ok {
+					continue
+				}
+				canonical, err := canonicalAttributeValue(attribute, value)
+				if err != nil || canonical == "" {
+					continue
+				}
+				attributeValue := models.ProductAttributeValue{ProductID: product.ID, AttributeID: attribute.ID, Value: canonical}
+				if err := tx.Create(&attributeValue).Error; err != nil {
+					return err
+				}
+			}
+			if err := recordProductRevision(tx, models.RevisionActionCreate, nil, &product, ownerID); err != nil {
+				return err
+			}
+			createdProducts++
+		}
+
+		for _, entry := range manifest.Campaigns {
+			campaign := models.Campaign{
+				OwnerID:         ownerID,
+				CollectionID:    mapRef(entry.CollectionRef),
+				Name:            entry.Name,
+				DiscountPercent: entry.DiscountPercent,
+				StartsAt:        entry.StartsAt,
+				EndsAt:          entry.EndsAt,
+				IsActive:        entry.IsActive,
+			}
+			if entry.CollectionRef != nil && campaign.CollectionID == nil {
+				continue
+			}
+			if err := tx.Create(&campaign).Error; err != nil {
+				return err
+			}
+		}
+
+		if logoURL != "" {
+			if err := tx.Model(&models.User{}).Where("id = ?", ownerID).Updates(map[string]any{"logo_url": logoURL, "logo_size_bytes": logoSize}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not restore backup"})
+		return
+	}
+	syncWatermarksAsync(ownerID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Backup restored",
+		"collections_created": createdCollections,
+		"products_created":    createdProducts,
+	})
+}
+
+// checkRestoreLimits responds with 403 and returns false when the backup
+// doesn't fit in the account's plan.
+func checkRestoreLimits(c *gin.Context, ownerID uint, manifest *backupManifest) bool {
+	_, plan, productCount, err := CheckProductLimit(ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+		return false
+	}
+	_, _, collectionCount, err := CheckCollectionLimit(ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+		return false
+	}
+
+	newProducts := 0
+	for _, product := range manifest.Products {
+		if product.Status != models.ProductStatusArchived {
+			newProducts++
+		}
+	}
+
+	if plan.MaxProducts != -1 && productCount+newProducts > plan.MaxProducts {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":            "Product limit reached",
+			"limit":            plan.MaxProducts,
+			"current_count":    productCount,
+			"plan_name":        plan.DisplayName,
+			"upgrade_required": true,
+		})
+		return false
+	}
+	if plan.MaxCollections != -1 && collectionCount+len(manifest.Collections) > plan.MaxCollections {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":            "Collection limit reached",
+			"limit":            plan.MaxCollections,
+			"current_count":    collectionCount,
+			"plan_name":        plan.DisplayName,
+			"upgrade_required": true,
+		})
+		return false
+	}
+	return true
+}
+
+// checkRestoreStorage responds with 403 and removes the restored files when
+// they don't fit in the storage left on the plan. A restored logo replaces
+// the current one, so its bytes are freed.
+func checkRestoreStorage(c *gin.Context, ownerID uint, savedImages map[string]string, logoURL string, logoSize int64) bool {
+	remaining, plan, used, err := CheckStorageLimit(ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+		return false
+	}
+	if remaining == -1 {
+		return true
+	}
+
+	urls := make([]string, 0, len(savedImages))
+	for _, url := range savedImages {
+		urls = append(urls, url)
+	}
+	stored, err := newImageBytes(ownerID, urls)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+		return false
+	}
+	stored += logoSize
+	if logoURL != "" {
+		var currentLogo int64
+		database.DB.Model(&models.User{}).Where("id = ?", ownerID).Select("logo_size_bytes").Scan(&currentLogo)
+		remaining += currentLogo
+	}
+
+	if stored > remaining {
+		// Image files may be shared with other products, so they are left to
+		// the upload collector.
+		removeUploadsIfUnused([]string{logoURL})
+		respondStorageLimit(c, plan, used)
+		return false
+	}
+	return true
+}
+
+func decodeZipJSON(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return json.NewDecoder(io.LimitReader(rc, 50*1024*1024)).Decode(v)
+}
+
+func openBackupImage(files map[string]*zip.File, archivePath string) (io.ReadCloser, error) {
+	f, ok := files[archivePath]
+	if !ok {
+		return nil, errors.New("image not found in backup")
+	}
+	if f.UncompressedSize64 > config.MaxImageSize {
+		return nil, errors.New("image too large")
+	}
+	return f.Open()
+}
+
+func restoreImage(files map[string]*zip.File, archivePath string) (string, error) {
+	rc, err := openBackupImage(files, archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return utils.SaveImageFromReader(io.LimitReader(rc, config.MaxImageSize))
+}
+
+func restoreLogo(files map[string]*zip.File, archivePath string, ownerID uint) (string, error) {
+	rc, err := openBackupImage(files, archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	key := fmt.Sprintf("logos/logo_%d_%d.jpg", ownerID, time.Now().Unix())
+	return utils.SaveCompressedImageFromReader(io.LimitReader(rc, config.MaxLogoSize), key)
+}
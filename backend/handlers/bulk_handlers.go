@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// bulkUpdate is the change planned for one product.
+type bulkUpdate struct {
+	product models.Product
+	updates map[string]any
+	change  models.BulkProductChange
+}
+
+// BulkUpdateProducts applies one action to a selection of products in a single
+// transaction. With dry_run the planned changes are returned and nothing is
+// saved.
+func BulkUpdateProducts(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input models.BulkProductInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	if len(input.ProductIDs) == 0 && input.Filter == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "product_ids or filter is required"})
+		return
+	}
+
+	query := database.DB.Where("owner_id = ?", ownerID)
+	if len(input.ProductIDs) > 0 {
+		query = query.Where("id IN ?", input.ProductIDs)
+	}
+	if input.Filter != nil {
+		query = applyBulkFilter(query, input.Filter)
+	}
+
+	var products []models.Product
+	if err := query.Order("id asc").Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve products"})
+		return
+	}
+
+	plan, err := planBulkUpdates(ownerID, &input, products)
+	if err != nil {
+		var limitErr *bulkLimitError
+		if errors.As(err, &limitErr) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":            "Product limit reached",
+				"limit":            limitErr.plan.MaxProducts,
+				"current_count":    limitErr.currentCount,
+				"plan_name":        limitErr.plan.DisplayName,
+				"upgrade_required": true,
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changes := make([]models.BulkProductChange, 0, len(plan))
+	for _, update := range plan {
+		changes = append(changes, update.change)
+	}
+
+	if !input.DryRun && len(plan) > 0 {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			return executeBulkUpdates(tx, ownerID, input.Action, plan)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not apply bulk operation"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"action":  input.Action,
+		"dry_run": input.DryRun,
+		"matched": len(products),
+		"changed": len(changes),
+		"changes": changes,
+	})
+}
+
+func applyBulkFilter(query *gorm.DB, filter *models.BulkProductFilter) *gorm.DB {
+	if filter.CollectionID != nil {
+		if *filter.CollectionID == 0 {
+			query = query.Where("collection_id IS NULL")
+		} else {
+			query = query.Where("collection_id = ?", *filter.CollectionID)
+		}
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	if filter.Tag != nil && strings.TrimSpace(*filter.Tag) != "" {
+		query = query.Where("(',' || LOWER(tags) || ',') LIKE ? ESCAPE '\\'", "%,"+escapeLike(strings.ToLower(strings.TrimSpace(*filter.Tag)))+",%")
+	}
+	if filter.Search != nil && strings.TrimSpace(*filter.Search) != "" {
+		query = query.Where("name ILIKE ? ESCAPE '\\'", "%"+escapeLike(strings.TrimSpace(*filter.Search))+"%")
+	}
+	return query
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike makes user input match literally inside a LIKE pattern.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+type bulkLimitError struct {
+	plan         *models.Plan
+	currentCount int
+}
+
+func (e *bulkLimitError) Error() string {
+	return "Product limit reached"
+}
+
+// planBulkUpdates computes the change for each product, validating the result
+// so that the whole operation either applies cleanly or not at all.
+func planBulkUpdates(ownerID uint, input *models.BulkProductInput, products []models.Product) ([]bulkUpdate, error) {
+	var plan []bulkUpdate
+
+	switch input.Action {
+	case models.BulkActionAdjustPrice:
+		if (input.PricePercent == nil) == (input.PriceAmount == nil) {
+			return nil, errors.New("exactly one of price_percent or price_amount is required")
+		}
+		for _, product := range products {
+			newPrice := product.Price
+			if input.PricePercent != nil {
+				newPrice = product.Price * (1 + *input.PricePercent/100)
+			} else {
+				newPrice = product.Price + *input.PriceAmount
+			}
+			newPrice = math.Round(newPrice*100) / 100
+
+			if err := validatePricing(newPrice, product.CompareAtPrice, product.SalePrice, product.SaleStartsAt, product.SaleEndsAt); err != nil {
+				return nil, fmt.Errorf("product %d (%s): %v", product.ID, product.Name, err)
+			}
+			if newPrice == product.Price {
+				continue
+			}
+			plan = append(plan, newBulkUpdate(product, "price", product.Price, newPrice))
+		}
+
+	case models.BulkActionMoveCollection:
+		if input.CollectionID == nil {
+			return nil, errors.New("collection_id is required")
+		}
+		var target *uint
+		if *input.CollectionID != 0 {
+			var collection models.Collection
+			if err := database.DB.Where("id = ? AND owner_id = ?", *input.CollectionID, ownerID).First(&collection).Error; err != nil {
+				return nil, errors.New("Invalid collection_id")
+			}
+			target = &collection.ID
+		}
+		for _, product := range products {
+			if sameCollection(product.CollectionID, target) {
+				continue
+			}
+			plan = append(plan, newBulkUpdate(product, "collection_id", product.CollectionID, target))
+		}
+
+	case models.BulkActionSetStatus:
+		if input.Status == nil || !models.IsValidProductStatus(*input.Status) {
+			return nil, errors.New("Invalid status")
+		}
+		unarchived := 0
+		for _, product := range products {
+			if product.Status == *input.Status {
+				continue
+			}
+			if product.Status == models.ProductStatusArchived {
+				unarchived++
+			}
+			plan = append(plan, newBulkUpdate(product, "status", product.Status, *input.Status))
+		}
+		if unarchived > 0 {
+			_, userPlan, currentCount, err := CheckProductLimit(ownerID)
+			if err != nil {
+				return nil, errors.New("Could not verify plan limits")
+			}
+			if userPlan.MaxProducts != -1 && currentCount+unarchived > userPlan.MaxProducts {
+				return nil, &bulkLimitError{plan: userPlan, currentCount: currentCount}
+			}
+		}
+
+	case models.BulkActionAddTags, models.BulkActionRemoveTags:
+		if len(input.Tags) == 0 {
+			return nil, errors.New("tags is required")
+		}
+		for _, product := range products {
+			newTags := product.Tags
+			if input.Action == models.BulkActionAddTags {
+				newTags = normalizeTags(append(splitTags(product.Tags), input.Tags...))
+			} else {
+				newTags = removeTags(product.Tags, input.Tags)
+			}
+			if newTags == product.Tags {
+				continue
+			}
+			plan = append(plan, newBulkUpdate(product, "tags", product.Tags, newTags))
+		}
+
+	case models.BulkActionDelete:
+		for _, product := range products {
+			plan = append(plan, bulkUpdate{
+				product: product,
+				change:  models.BulkProductChange{ProductID: product.ID, Name: product.Name},
+			})
+		}
+
+	default:
+		return nil, errors.New("Invalid action")
+	}
+
+	return plan, nil
+}
+
+func newBulkUpdate(product models.Product, column string, before, after any) bulkUpdate {
+	return bulkUpdate{
+		product: product,
+		updates: map[string]any{column: after},
+		change: models.BulkProductChange{
+			ProductID: product.ID,
+			Name:      product.Name,
+			Before:    map[string]any{column: before},
+			After:     map[string]any{column: after},
+		},
+	}
+}
+
+func executeBulkUpdates(tx *gorm.DB, ownerID uint, action string, plan []bulkUpdate) error {
+	for i := range plan {
+		before := &plan[i].product
+
+		if action == models.BulkActionDelete {
+			if err := tx.Where("id = ? AND owner_id = ?", before.ID, ownerID).Delete(&models.Product{}).Error; err != nil {
+				return err
+			}
+			if err := recordProductRevision(tx, models.RevisionActionDelete, before, before, ownerID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := tx.Model(&models.Product{}).
+			Where("id = ? AND owner_id = ?", before.ID, ownerID).
+			Updates(plan[i].updates).Error; err != nil {
+			return err
+		}
+		var after models.Product
+		if err := tx.First(&after, before.ID).Error; err != nil {
+			return err
+		}
+		if err := recordProductRevision(tx, models.RevisionActionUpdate, before, &after, ownerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sameCollection(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func removeTags(current string, remove []string) string {
+	drop := map[string]bool{}
+	for _, tag := range remove {
+		drop[strings.ToLower(strings.TrimSpace(tag))] = true
+	}
+	var kept []string
+	for _, tag := range splitTags(current) {
+		if !drop[strings.ToLower(strings.TrimSpace(tag))] {
+			kept = append(kept, tag)
+		}
+	}
+	return normalizeTags(kept)
+}
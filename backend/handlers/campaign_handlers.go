@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func validateCampaign(discountPercent float64, startsAt, endsAt *time.Time) error {
+	if discountPercent <= 0 || discountPercent >= 100 {
+		return errors.New("discount_percent must be between 0 and 100")
+	}
+	if startsAt != nil && endsAt != nil && !endsAt.After(*startsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+func CreateCampaign(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input models.CreateCampaignInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	if err := validateCampaign(input.DiscountPercent, input.StartsAt, input.EndsAt); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.CollectionID != nil {
+		var collection models.Collection
+		if err := database.DB.Where("id = ? AND owner_id = ?", *input.CollectionID, ownerID).First(&collection).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection_id"})
+			return
+		}
+	}
+
+	campaign := models.Campaign{
+		OwnerID:         ownerID,
+		CollectionID:    input.CollectionID,
+		Name:            input.Name,
+		DiscountPercent: input.DiscountPercent,
+		StartsAt:        input.StartsAt,
+		EndsAt:          input.EndsAt,
+		IsActive:        true,
+	}
+
+	if err := database.DB.Create(&campaign).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create campaign"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, campaign)
+}
+
+func GetMyCampaigns(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var campaigns []models.Campaign
+	if err := database.DB.Where("owner_id = ?", ownerID).Order("created_at desc").Find(&campaigns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve campaigns"})
+		return
+	}
+
+	c.JSON(http.StatusOK, campaigns)
+}
+
+func UpdateCampaign(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var input models.UpdateCampaignInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	var campaign models.Campaign
+	if err := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&campaign).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve campaign"})
+		return
+	}
+
+	updates := map[string]any{}
+	if input.Name != nil {
+		campaign.Name = *input.Name
+		updates["name"] = *input.Name
+	}
+	if input.DiscountPercent != nil {
+		campaign.DiscountPercent = *input.DiscountPercent
+		updates["discount_percent"] = *input.DiscountPercent
+	}
+	if input.ClearCollection {
+		campaign.CollectionID = nil
+		updates["collection_id"] = nil
+	} else if input.CollectionID != nil {
+		var collection models.Collection
+		if err := database.DB.Where("id = ? AND owner_id = ?", *input.CollectionID, ownerID).First(&collection).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection_id"})
+			return
+		}
+		campaign.CollectionID = input.CollectionID
+		updates["collection_id"] = input.CollectionID
+	}
+	if input.ClearStartsAt {
+		campaign.StartsAt = nil
+		updates["starts_at"] = nil
+	} else if input.StartsAt != nil {
+		campaign.StartsAt = input.StartsAt
+		updates["starts_at"] = input.StartsAt
+	}
+	if input.ClearEndsAt {
+		campaign.EndsAt = nil
+		updates["ends_at"] = nil
+	} else if input.EndsAt != nil {
+		campaign.EndsAt = input.EndsAt
+		updates["ends_at"] = input.EndsAt
+	}
+	if input.IsActive != nil {
+		campaign.IsActive = *input.IsActive
+		updates["is_active"] = *input.IsActive
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	if err := validateCampaign(campaign.DiscountPercent, campaign.StartsAt, campaign.EndsAt); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Model(&campaign).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update campaign"})
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+func DeleteCampaign(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	result := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).Delete(&models.Campaign{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete campaign"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/FelippeTN/Web-Catalogo/backend/database"
 	"github.com/FelippeTN/Web-Catalogo/backend/models"
@@ -74,11 +75,19 @@ func CreateCollection(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
 		return
 	}
+	if input.Visibility == "" {
+		input.Visibility = models.CollectionPublic
+	}
+	if !models.IsValidCollectionVisibility(input.Visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid visibility"})
+		return
+	}
 
 	collection := models.Collection{
 		OwnerID:     ownerID,
 		Name:        input.Name,
 		Description: input.Description,
+		Visibility:  input.Visibility,
 	}
 
 	if err := database.DB.Create(&collection).Error; err != nil {
@@ -131,6 +140,13 @@ func UpdateCollection(c *gin.Context) {
 	if input.Description != nil {
 		updates["description"] = *input.Description
 	}
+	if input.Visibility != nil {
+		if !models.IsValidCollectionVisibility(*input.Visibility) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid visibility"})
+			return
+		}
+		updates["visibility"] = *input.Visibility
+	}
 
 	if len(updates) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
@@ -179,26 +195,23 @@ func DeleteCollection(c *gin.Context) {
 			return err
 		}
 
-		var productIDs []uint
-		if err := tx.Model(&models.Product{}).Where("owner_id = ? AND collection_id = ?", ownerID, collectionID).Pluck("id", &productIDs).Error; err != nil {
+		// Products are trashed together with the collection, sharing its
+		// deleted_at so RestoreCollection can bring back exactly this batch.
+		now := time.Now()
+		var products []models.Product
+		if err := tx.Where("owner_id = ? AND collection_id = ?", ownerID, collectionID).Find(&products).Error; err != nil {
 			return err
 		}
-
-		if len(productIDs) > 0 {
-			if err := tx.Where("product_id IN ?", productIDs).Delete(&models.OrderItem{}).Error; err != nil {
+		for i := range products {
+			if err := tx.Model(&products[i]).Update("deleted_at", now).Error; err != nil {
 				return err
 			}
-
-			if err := tx.Where("product_id IN ?", productIDs).Delete(&models.ProductImage{}).Error; err != nil {
+			if err := recordProductRevision(tx, models.RevisionActionDelete, &products[i], &products[i], ownerID); err != nil {
 				return err
 			}
 		}
 
-		if err := tx.Where("owner_id = ? AND collection_id = ?", ownerID, collectionID).Delete(&models.Product{}).Error; err != nil {
-			return err
-		}
-
-		if err := tx.Where("id = ? AND owner_id = ?", collectionID, ownerID).Delete(&models.Collection{}).Error; err != nil {
+		if err := tx.Model(&models.Collection{}).Where("id = ? AND owner_id = ?", collectionID, ownerID).Update("deleted_at", now).Error; err != nil {
 			return err
 		}
 
@@ -230,7 +243,7 @@ func GetPublicCollections(c *gin.Context) {
 	}
 
 	var collections []models.Collection
-	if err := database.DB.Where("owner_id = ?", uint(ownerIDParsed)).Order("created_at desc").Find(&collections).Error; err != nil {
+	if err := database.DB.Where("owner_id = ? AND visibility = ?", uint(ownerIDParsed), models.CollectionPublic).Order("created_at desc").Find(&collections).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve collections"})
 		return
 	}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const copyNameSuffix = " (cópia)"
+
+func DuplicateProduct(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var source models.Product
+	if err := database.DB.Scopes(withProductRelations).Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&source).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve product"})
+		return
+	}
+
+	if source.Status != models.ProductStatusArchived {
+		canCreate, plan, currentCount, err := CheckProductLimit(ownerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+			return
+		}
+		if !canCreate {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":            "Product limit reached",
+				"limit":            plan.MaxProducts,
+				"current_count":    currentCount,
+				"plan_name":        plan.DisplayName,
+				"upgrade_required": true,
+			})
+			return
+		}
+	}
+
+	// The copy shares the image files, which storageUsedBytes counts once, so
+	// it needs no storage check.
+	var clone models.Product
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		clone, err = cloneProduct(tx, &source, source.CollectionID, source.Name+copyNameSuffix)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not duplicate product"})
+		return
+	}
+
+	database.DB.Scopes(withProductRelations).First(&clone, clone.ID)
+	if err := applyProductPricing(&clone); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not compute prices"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, clone)
+}
+
+func DuplicateCollection(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var source models.Collection
+	if err := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&source).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve collection"})
+		return
+	}
+
+	var products []models.Product
+	if err := database.DB.Scopes(withProductRelations).Where("owner_id = ? AND collection_id = ?", ownerID, source.ID).Order("created_at asc").Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve products"})
+		return
+	}
+
+	canCreate, plan, currentCount, err := CheckCollectionLimit(ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+		return
+	}
+	if !canCreate {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":            "Collection limit reached",
+			"limit":            plan.MaxCollections,
+			"current_count":    currentCount,
+			"plan_name":        plan.DisplayName,
+			"upgrade_required": true,
+		})
+		return
+	}
+
+	newProducts := 0
+	for _, product := range products {
+		if product.Status != models.ProductStatusArchived {
+			newProducts++
+		}
+	}
+	_, plan, productCount, err := CheckProductLimit(ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+		return
+	}
+	if plan.MaxProducts != -1 && productCount+newProducts > plan.MaxProducts {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":            "Product limit reached",
+			"limit":            plan.MaxProducts,
+			"current_count":    productCount,
+			"plan_name":        plan.DisplayName,
+			"upgrade_required": true,
+		})
+		return
+	}
+
+	clone := models.Collection{
+		OwnerID:     ownerID,
+		Name:        source.Name + copyNameSuffix,
+		Description: source.Description,
+		Visibility:  source.Visibility,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&clone).Error; err != nil {
+			return err
+		}
+		for i := range products {
+			if _, err := cloneProduct(tx, &products[i], &clone.ID, products[i].Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not duplicate collection"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, clone)
+}
+
+// cloneProduct creates a copy of source inside tx. The copy's images share
+// the files of the original ones; see models.ImageFile.
+func cloneProduct(tx *gorm.DB, source *models.Product, collectionID *uint, name string) (models.Product, error) {
+	clone := *source
+	clone.ID = 0
+	clone.CollectionID = collectionID
+	clone.Name = name
+	clone.ImageURL = nil
+	clone.Images = nil
+	clone.Attributes = nil
+	// SKU and barcode identify the original item, not the copy.
+	clone.SKU = nil
+	clone.Barcode = nil
+	clone.CreatedAt = time.Time{}
+	clone.UpdatedAt = time.Time{}
+
+	if source.ImageURL != nil {
+		imageURL := *source.ImageURL
+		clone.ImageURL = &imageURL
+	}
+
+	if err := tx.Omit("Images", "Attributes").Create(&clone).Error; err != nil {
+		return clone, err
+	}
+
+	for _, attribute := range source.Attributes {
+		value := models.ProductAttributeValue{
+			ProductID:   clone.ID,
+			AttributeID: attribute.AttributeID,
+			Value:       attribute.Value,
+		}
+		if err := tx.Create(&value).Error; err != nil {
+			return clone, err
+		}
+	}
+
+	images := make([]models.ProductImage, len(source.Images))
+	for i, image := range source.Images {
+		images[i] = models.ProductImage{
+			ImageURL:  image.ImageURL,
+			AltText:   image.AltText,
+			Position:  image.Position,
+			Variants:  image.Variants,
+			SizeBytes: image.SizeBytes,
+
+			Watermarked:        image.Watermarked,
+			WatermarkSignature: image.WatermarkSignature,
+		}
+	}
+	if err := createProductImages(tx, clone.ID, images); err != nil {
+		return clone, err
+	}
+
+	if err := recordProductRevision(tx, models.RevisionActionCreate, nil, &clone, clone.OwnerID); err != nil {
+		return clone, err
+	}
+
+	return clone, nil
+}
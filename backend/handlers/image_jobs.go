@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/config"
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/utils"
+	"gorm.io/gorm"
+)
+
+// imageJobTimeout hands a job to another worker when the one running it
+// stopped reporting, e.g. because the server was restarted.
+const imageJobTimeout = 10 * time.Minute
+
+// claimImageJobQuery marks the next due job as running and returns it. SKIP
+// LOCKED lets several workers, across servers too, poll the same table.
+const claimImageJobQuery = `
+	UPDATE image_jobs SET status = ?, attempts = attempts + 1, updated_at = NOW()
+	WHERE id = (
+		SELECT id FROM image_jobs
+		WHERE (status = ? AND run_after <= NOW()) OR (status = ? AND updated_at < ?)
+		ORDER BY run_after, id
+		FOR UPDATE SKIP LOCKED
+		LIMIT 1
+	)
+	RETURNING *`
+
+// ImageWorkers is the number of images processed at once. It can be
+// overridden with IMAGE_WORKERS.
+func ImageWorkers() int {
+	if v, err := strconv.Atoi(os.Getenv("IMAGE_WORKERS")); err == nil && v > 0 {
+		return v
+	}
+	return config.ImageWorkers
+}
+
+// StartImageWorkers starts workers that process queued images, looking for
+// new jobs at every interval when the queue is empty.
+func StartImageWorkers(workers int, interval time.Duration) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				processed, err := runNextImageJob()
+				if err != nil {
+					log.Printf("Image worker failed: %v", err)
+				}
+				if !processed {
+					time.Sleep(interval)
+				}
+			}
+		}()
+	}
+}
+
+// runNextImageJob runs the next due job, if any, and records its outcome.
+func runNextImageJob() (bool, error) {
+	var job models.ImageJob
+	result := database.DB.Raw(claimImageJobQuery,
+		models.ImageJobRunning, models.ImageJobPending, models.ImageJobRunning, time.Now().Add(-imageJobTimeout),
+	).Scan(&job)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 || job.ID == 0 {
+		return false, nil
+	}
+
+	jobErr := processImage(job.ImageID)
+	now := time.Now()
+	switch {
+	case jobErr == nil:
+		return true, database.DB.Delete(&job).Error
+	case job.Attempts < config.ImageJobMaxAttempts:
+		log.Printf("Image job %d failed (attempt %d): %v", job.ID, job.Attempts, jobErr)
+		return true, database.DB.Model(&job).Updates(map[string]any{
+			"status":     models.ImageJobPending,
+			"last_error": jobErr.Error(),
+			"run_after":  now.Add(time.Duration(job.Attempts*job.Attempts) * 30 * time.Second),
+		}).Error
+	default:
+		log.Printf("Image job %d gave up after %d attempts: %v", job.ID, job.Attempts, jobErr)
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			err := tx.Model(&job).Updates(map[string]any{
+				"status":      models.ImageJobFailed,
+				"last_error":  jobErr.Error(),
+				"finished_at": &now,
+			}).Error
+			if err != nil {
+				return err
+			}
+			return tx.Model(&models.ProductImage{}).
+				Where("id = ? AND status = ?", job.ImageID, models.ProductImageProcessing).
+				Updates(map[string]any{
+					"status":           models.ProductImageFailed,
+					"processing_error": processingError(jobErr),
+				}).Error
+		})
+		return true, err
+	}
+}
+
+// processImage compresses an uploaded image and generates its variants,
+// then marks every image waiting on the same file as ready.
+func processImage(imageID uint) error {
+	var image models.ProductImage
+	if err := database.DB.First(&image, imageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Deleted while queued; its upload is left to the collector.
+			return nil
+		}
+		return err
+	}
+	if image.Status != models.ProductImageProcessing {
+		return nil
+	}
+
+	if err := utils.ProcessPendingImage(image.ImageURL); err != nil {
+		return err
+	}
+	variants, err := utils.GenerateImageVariants(image.ImageURL)
+	if err != nil {
+		return err
+	}
+	image.Variants = variants
+
+	err = database.DB.Model(&models.ProductImage{}).
+		Where("image_url = ? AND status <> ?", image.ImageURL, models.ProductImageReady).
+		Updates(map[string]any{
+			"variants":         image.Variants,
+			"size_bytes":       storedImageBytes(image),
+			"status":           models.ProductImageReady,
+			"processing_error": "",
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	// Watermarks are drawn in the background so a store with many images
+	// doesn't hold up the workers.
+	var ownerIDs []uint
+	database.DB.Unscoped().Model(&models.Product{}).
+		Where("id IN (?)", database.DB.Model(&models.ProductImage{}).Select("product_id").Where("image_url = ?", image.ImageURL)).
+		Distinct().Pluck("owner_id", &ownerIDs)
+	for _, ownerID := range ownerIDs {
+		syncWatermarksAsync(ownerID)
+	}
+	return nil
+}
+
+// processingError is the reason shown to the owner of an image that could
+// not be processed.
+func processingError(err error) string {
+	if errors.Is(err, utils.ErrUnsupportedImage) || errors.Is(err, utils.ErrImageTooManyPixels) {
+		return err.Error()
+	}
+	return "não foi possível processar a imagem"
+}
@@ -0,0 +1,620 @@
+package handlers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/config"
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxImportFileSize = 5 * 1024 * 1024   // 5MB
+	maxImportZipSize  = 200 * 1024 * 1024 // 200MB
+	maxImportRows     = 1000
+)
+
+// importJobTimeout fails a job that stopped reporting progress, e.g.
+// because the server running it was restarted.
+const importJobTimeout = 15 * time.Minute
+
+// importColumnAliases maps normalised header names, in English and
+// Portuguese, to the import field they fill.
+var importColumnAliases = map[string]string{
+	"name":        "name",
+	"nome":        "name",
+	"description": "description",
+	"descricao":   "description",
+	"price":       "price",
+	"preco":       "price",
+	"sizes":       "sizes",
+	"tamanhos":    "sizes",
+	"collection":  "collection",
+	"colecao":     "collection",
+	"vitrine":     "collection",
+	"tags":        "tags",
+	"etiquetas":   "tags",
+	"stock":       "stock",
+	"estoque":     "stock",
+	"sku":         "sku",
+	"barcode":     "barcode",
+	"ean":         "barcode",
+	"gtin":        "barcode",
+	"images":      "images",
+	"imagens":     "images",
+}
+
+var headerReplacer = strings.NewReplacer("ç", "c", "ã", "a", "á", "a", "â", "a", "é", "e", "ê", "e", "í", "i", "ó", "o", "ô", "o", "õ", "o", "ú", "u", " ", "_")
+
+// importRow is a spreadsheet row already split into named fields.
+type importRow struct {
+	Number int
+	Fields map[string]string
+}
+
+// importArchive is the ZIP of images sent with an import. It is copied to
+// a temporary file, which outlives the request, rather than kept in memory
+// while the job runs.
+type importArchive struct {
+	path   string
+	reader *zip.ReadCloser
+	files  map[string]*zip.File // by lower-cased base name
+}
+
+// spoolImportArchive copies an uploaded ZIP to a temporary file and opens it.
+func spoolImportArchive(fileHeader *multipart.FileHeader) (*importArchive, error) {
+	reader, tmpPath, err := spoolZipFile(fileHeader, maxImportZipSize, "import-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	archive := &importArchive{path: tmpPath, reader: reader, files: map[string]*zip.File{}}
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		archive.files[strings.ToLower(path.Base(f.Name))] = f
+	}
+	return archive, nil
+}
+
+// spoolZipFile copies an uploaded ZIP of up to maxSize bytes to a temporary
+// file named after pattern and opens it, so large archives aren't held in
+// memory. The caller closes the reader and removes the returned path.
+func spoolZipFile(fileHeader *multipart.FileHeader, maxSize int64, pattern string) (*zip.ReadCloser, string, error) {
+	src, err := fileHeader.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, "", err
+	}
+	n, err := io.Copy(tmp, io.LimitReader(src, maxSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > maxSize {
+		err = errors.New("file too large")
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, "", err
+	}
+
+	reader, err := zip.OpenReader(tmp.Name())
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, "", err
+	}
+	return reader, tmp.Name(), nil
+}
+
+// Close closes the archive and deletes its temporary file.
+func (a *importArchive) Close() {
+	if a == nil {
+		return
+	}
+	a.reader.Close()
+	os.Remove(a.path)
+}
+
+func ImportProducts(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Import file not provided"})
+		return
+	}
+	if fileHeader.Size > maxImportFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Import file too large"})
+		return
+	}
+
+	data, err := readFormFile(fileHeader, maxImportFileSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read import file"})
+		return
+	}
+
+	var records [][]string
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".csv":
+		records, err = utils.ReadCSV(data)
+	case ".xlsx":
+		records, err = utils.ReadXLSX(data)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported file type. Use CSV or XLSX"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not parse import file"})
+		return
+	}
+
+	rows, err := buildImportRows(records)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var archive *importArchive
+	if zipHeader, err := c.FormFile("images"); err == nil {
+		if zipHeader.Size > maxImportZipSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Images archive too large"})
+			return
+		}
+		archive, err = spoolImportArchive(zipHeader)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid images archive"})
+			return
+		}
+	}
+
+	job := models.ImportJob{
+		OwnerID:   ownerID,
+		Status:    models.ImportJobPending,
+		FileName:  fileHeader.Filename,
+		TotalRows: len(rows),
+	}
+	if err := database.DB.Create(&job).Error; err != nil {
+		archive.Close()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create import job"})
+		return
+	}
+
+	go runProductImport(job.ID, ownerID, rows, archive)
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+func GetImportJob(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var job models.ImportJob
+	if err := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Import job not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve import job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func GetMyImportJobs(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var jobs []models.ImportJob
+	if err := database.DB.Where("owner_id = ?", ownerID).Order("created_at desc").Limit(20).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve import jobs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+func readFormFile(fileHeader *multipart.FileHeader, maxSize int64) ([]byte, error) {
+	src, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errors.New("file too large")
+	}
+	return data, nil
+}
+
+// buildImportRows maps the header row to import fields and returns the data
+// rows, skipping blank ones.
+func buildImportRows(records [][]string) ([]importRow, error) {
+	if len(records) < 2 {
+		return nil, errors.New("Import file has no data rows")
+	}
+
+	columns := map[int]string{}
+	seen := map[string]bool{}
+	for i, header := range records[0] {
+		key := headerReplacer.Replace(strings.ToLower(strings.TrimSpace(header)))
+		if field, ok := importColumnAliases[key]; ok && !seen[field] {
+			columns[i] = field
+			seen[field] = true
+		}
+	}
+	if !seen["name"] || !seen["price"] {
+		return nil, errors.New("Import file must have name and price columns")
+	}
+
+	var rows []importRow
+	for i, record := range records[1:] {
+		fields := map[string]string{}
+		blank := true
+		for col, value := range record {
+			field, ok := columns[col]
+			if !ok {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			if value != "" {
+				blank = false
+			}
+			fields[field] = value
+		}
+		if blank {
+			continue
+		}
+		rows = append(rows, importRow{Number: i + 2, Fields: fields})
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("Import file has no data rows")
+	}
+	if len(rows) > maxImportRows {
+		return nil, fmt.Errorf("Import file exceeds the limit of %d rows", maxImportRows)
+	}
+	return rows, nil
+}
+
+func runProductImport(jobID uint, ownerID uint, rows []importRow, archive *importArchive) {
+	var rowErrors models.ImportRowErrors
+	created := 0
+
+	defer archive.Close()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Import job %d panicked: %v", jobID, r)
+			now := time.Now()
+			runningImportJob(jobID).Updates(map[string]any{
+				"status":      models.ImportJobFailed,
+				"message":     "Unexpected error while importing",
+				"errors":      rowErrors,
+				"finished_at": &now,
+			})
+		}
+	}()
+
+	started := database.DB.Model(&models.ImportJob{}).
+		Where("id = ? AND status = ?", jobID, models.ImportJobPending).
+		Update("status", models.ImportJobRunning)
+	if started.Error != nil || started.RowsAffected == 0 {
+		return
+	}
+
+	var collections []models.Collection
+	database.DB.Where("owner_id = ?", ownerID).Find(&collections)
+	collectionIDs := map[string]uint{}
+	for _, collection := range collections {
+		collectionIDs[strings.ToLower(collection.Name)] = collection.ID
+	}
+
+	for i, row := range rows {
+		if err := importProductRow(ownerID, row, archive, collectionIDs); err != nil {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row.Number, Error: err.Error()})
+		} else {
+			created++
+		}
+
+		progress := runningImportJob(jobID).Updates(map[string]any{
+			"processed_rows": i + 1,
+			"created_count":  created,
+			"failed_count":   len(rowErrors),
+		})
+		// FailStaleImportJobs gave up on the job; stop adding products
+		if progress.Error == nil && progress.RowsAffected == 0 {
+			return
+		}
+	}
+
+	now := time.Now()
+	runningImportJob(jobID).Updates(map[string]any{
+		"status":      models.ImportJobCompleted,
+		"errors":      rowErrors,
+		"finished_at": &now,
+	})
+	if created > 0 {
+		syncWatermarksAsync(ownerID)
+	}
+}
+
+// runningImportJob scopes a write to the job while it is still running, so a
+// job that FailStaleImportJobs already failed keeps its final status.
+func runningImportJob(jobID uint) *gorm.DB {
+	return database.DB.Model(&models.ImportJob{}).Where("id = ? AND status = ?", jobID, models.ImportJobRunning)
+}
+
+func importProductRow(ownerID uint, row importRow, archive *importArchive, collectionIDs map[string]uint) error {
+	name := row.Fields["name"]
+	if name == "" {
+		return errors.New("name is required")
+	}
+
+	price, err := parseImportPrice(row.Fields["price"])
+	if err != nil || price <= 0 {
+		return errors.New("invalid price")
+	}
+
+	var stock *int
+	if raw := row.Fields["stock"]; raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return errors.New("invalid stock")
+		}
+		stock = &value
+	}
+
+	var imageRefs []string
+	for _, ref := range strings.FieldsFunc(row.Fields["images"], func(r rune) bool { return r == '|' || r == ';' }) {
+		if ref = strings.TrimSpace(ref); ref != "" {
+			imageRefs = append(imageRefs, ref)
+		}
+	}
+	catalog := models.Product{
+		OwnerID: ownerID,
+		SKU:     normalizeCode(stringPtr(row.Fields["sku"])),
+		Barcode: normalizeCode(stringPtr(row.Fields["barcode"])),
+	}
+	if err := validateCatalogFields(database.DB, &catalog); err != nil {
+		return err
+	}
+
+	canCreate, plan, _, err := CheckProductLimit(ownerID)
+	if err != nil {
+		return errors.New("could not verify plan limits")
+	}
+	if !canCreate {
+		return fmt.Errorf("product limit of plan %s reached", plan.DisplayName)
+	}
+	if plan.MaxImagesPerProduct != -1 && len(imageRefs) > plan.MaxImagesPerProduct {
+		return fmt.Errorf("at most %d images allowed per product", plan.MaxImagesPerProduct)
+	}
+
+	remainingStorage := int64(-1)
+	if len(imageRefs) > 0 {
+		remainingStorage, _, _, err = CheckStorageLimit(ownerID)
+		if err != nil {
+			return errors.New("could not verify plan limits")
+		}
+		if remainingStorage == 0 {
+			return fmt.Errorf("storage limit of plan %s reached", plan.DisplayName)
+		}
+	}
+
+	var collectionID *uint
+	if collectionName := row.Fields["collection"]; collectionName != "" {
+		id, err := findOrCreateImportCollection(ownerID, collectionName, collectionIDs)
+		if err != nil {
+			return err
+		}
+		collectionID = &id
+	}
+
+	// Images left behind on failure may be shared with other products, so
+	// they are left to the upload collector.
+	var uploaded []string
+	for _, ref := range imageRefs {
+		url, err := importImage(ref, archive)
+		if err != nil {
+			return fmt.Errorf("image %q: %v", ref, importImageError(err))
+		}
+		uploaded = append(uploaded, url)
+	}
+	if remainingStorage > 0 {
+		stored, err := newImageBytes(ownerID, uploaded)
+		if err != nil {
+			return errors.New("could not verify plan limits")
+		}
+		if stored > remainingStorage {
+			return fmt.Errorf("storage limit of plan %s reached", plan.DisplayName)
+		}
+	}
+
+	product := models.Product{
+		OwnerID:      ownerID,
+		CollectionID: collectionID,
+		Name:         name,
+		Description:  row.Fields["description"],
+		Price:        price,
+		Sizes:        normalizeSizes(row.Fields["sizes"]),
+		Tags:         normalizeTags(splitTags(row.Fields["tags"])),
+		Stock:        stock,
+		SKU:          catalog.SKU,
+		Barcode:      catalog.Barcode,
+		Status:       models.ProductStatusPublished,
+	}
+	if len(uploaded) > 0 {
+		product.ImageURL = &uploaded[0]
+	}
+
+	productImages := newProductImages(uploaded)
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&product).Error; err != nil {
+			return errors.New("could not create product")
+		}
+		if err := createProductImages(tx, product.ID, productImages); err != nil {
+			return errors.New("could not save product images")
+		}
+		return recordProductRevision(tx, models.RevisionActionCreate, nil, &product, ownerID)
+	})
+}
+
+func findOrCreateImportCollection(ownerID uint, name string, collectionIDs map[string]uint) (uint, error) {
+	key := strings.ToLower(name)
+	if id, ok := collectionIDs[key]; ok {
+		return id, nil
+	}
+
+	canCreate, plan, _, err := CheckCollectionLimit(ownerID)
+	if err != nil {
+		return 0, errors.New("could not verify plan limits")
+	}
+	if !canCreate {
+		return 0, fmt.Errorf("collection limit of plan %s reached", plan.DisplayName)
+	}
+
+	collection := models.Collection{OwnerID: ownerID, Name: name}
+	if err := database.DB.Create(&collection).Error; err != nil {
+		return 0, errors.New("could not create collection")
+	}
+	collectionIDs[key] = collection.ID
+	return collection.ID, nil
+}
+
+// importImage saves an image referenced by a row, either a remote URL or the
+// name of a file inside the uploaded ZIP archive.
+func importImage(ref string, archive *importArchive) (string, error) {
+	lower := strings.ToLower(ref)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		return utils.DownloadImage(ref, config.MaxImageSize)
+	}
+
+	if archive == nil {
+		return "", errors.New("not found in images archive")
+	}
+	f, ok := archive.files[strings.ToLower(path.Base(ref))]
+	if !ok {
+		return "", errors.New("not found in images archive")
+	}
+	if f.UncompressedSize64 > config.MaxImageSize {
+		return "", fmt.Errorf("image exceeds the %dMB limit", config.MaxImageSize/(1024*1024))
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return "", errors.New("could not read from images archive")
+	}
+	defer rc.Close()
+
+	return utils.SaveImageFromReader(io.LimitReader(rc, config.MaxImageSize))
+}
+
+// importImageError words the image validation errors, shared with the
+// Portuguese upload forms, in English like the rest of the import report.
+func importImageError(err error) error {
+	switch {
+	case errors.Is(err, utils.ErrUnsupportedImage):
+		return errors.New("unsupported image format, use JPEG, PNG or WebP")
+	case errors.Is(err, utils.ErrImageTooManyPixels):
+		return errors.New("image dimensions exceed the limit")
+	}
+	return err
+}
+
+// FailStaleImportJobs marks as failed the jobs that stopped reporting
+// progress for importJobTimeout. Jobs run in the server that received the
+// file, so one interrupted by a restart never resumes.
+func FailStaleImportJobs() error {
+	now := time.Now()
+	return database.DB.Model(&models.ImportJob{}).
+		Where("status IN ? AND updated_at < ?", []string{models.ImportJobPending, models.ImportJobRunning}, now.Add(-importJobTimeout)).
+		Updates(map[string]any{
+			"status":      models.ImportJobFailed,
+			"message":     "Import interrupted, please send the file again",
+			"finished_at": &now,
+		}).Error
+}
+
+// StartImportJobRecovery runs FailStaleImportJobs now and then at every
+// interval.
+func StartImportJobRecovery(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := FailStaleImportJobs(); err != nil {
+				log.Printf("Import job recovery failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// parseImportPrice accepts both "1234.56" and the pt-BR "R$ 1.234,56" forms.
+func parseImportPrice(raw string) (float64, error) {
+	raw = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(raw), "R$"))
+	raw = strings.ReplaceAll(raw, " ", "")
+	if strings.Contains(raw, ",") {
+		raw = strings.ReplaceAll(raw, ".", "")
+		raw = strings.ReplaceAll(raw, ",", ".")
+	}
+	return strconv.ParseFloat(raw, 64)
+}
+
+// normalizeSizes turns "P; M ;G" or "P,M,G" into the "P,M,G" form used by the
+// product forms.
+func normalizeSizes(raw string) string {
+	var sizes []string
+	for _, size := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == ';' || r == '|' }) {
+		if size = strings.TrimSpace(size); size != "" {
+			sizes = append(sizes, size)
+		}
+	}
+	return strings.Join(sizes, ",")
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -32,7 +33,7 @@ func UploadLogo(c *gin.Context) {
 	}
 
 	if !utils.IsImageFile(file) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Tipo de arquivo inválido. Use JPEG ou PNG"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tipo de arquivo inválido. Use JPEG, PNG ou WebP"})
 		return
 	}
 
@@ -41,26 +42,41 @@ func UploadLogo(c *gin.Context) {
 		return
 	}
 
-	logosDir := "./uploads/logos"
-	if err := utils.CreateDirIfNotExists(logosDir); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar diretório: " + err.Error()})
+	key := fmt.Sprintf("logos/logo_%v_%d.jpg", userID, time.Now().Unix())
+
+	logoURL, err := utils.SaveCompressedImage(file, key)
+	if errors.Is(err, utils.ErrUnsupportedImage) || errors.Is(err, utils.ErrImageTooManyPixels) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	filename := fmt.Sprintf("logo_%v_%d.jpg", userID, time.Now().Unix())
-	destPath := fmt.Sprintf("%s/%s", logosDir, filename)
-
-	if err := utils.SaveCompressedImage(file, destPath); err != nil {
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao processar imagem: " + err.Error()})
 		return
 	}
 
-	logoURL := fmt.Sprintf("/uploads/logos/%s", filename)
+	// The previous logo's bytes are freed by the replacement.
+	logoSize, _ := utils.UploadSize(logoURL)
+	remainingStorage, plan, storageUsed, err := CheckStorageLimit(user.ID)
+	if err != nil {
+		utils.RemoveUpload(logoURL)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao verificar limites do plano"})
+		return
+	}
+	if remainingStorage != -1 && logoSize > remainingStorage+user.LogoSizeBytes {
+		utils.RemoveUpload(logoURL)
+		respondStorageLimit(c, plan, storageUsed)
+		return
+	}
+
+	previousLogo := user.LogoURL
 	user.LogoURL = logoURL
+	user.LogoSizeBytes = logoSize
 	if err := database.DB.Save(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar logo: " + err.Error()})
 		return
 	}
+	removeUploadsIfUnused([]string{previousLogo})
+	syncWatermarksAsync(user.ID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Logo atualizada com sucesso", "logo_url": logoURL})
 }
@@ -78,11 +94,15 @@ func DeleteLogo(c *gin.Context) {
 		return
 	}
 
+	previousLogo := user.LogoURL
 	user.LogoURL = ""
+	user.LogoSizeBytes = 0
 	if err := database.DB.Save(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover logo"})
 		return
 	}
+	removeUploadsIfUnused([]string{previousLogo})
+	syncWatermarksAsync(user.ID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Logo removida com sucesso"})
 }
@@ -17,8 +17,8 @@ func GetCatalogMetadata(c *gin.Context) {
 		return
 	}
 
-	var collection models.Collection
-	if err := database.DB.Where("share_token = ?", token).First(&collection).Error; err != nil {
+	collection, err := findSharedCollection(token)
+	if err != nil {
 		c.String(http.StatusNotFound, "Catalog not found")
 		return
 	}
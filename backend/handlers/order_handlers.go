@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/FelippeTN/Web-Catalogo/backend/database"
 	"github.com/FelippeTN/Web-Catalogo/backend/models"
@@ -26,6 +28,8 @@ func CreateOrder(c *gin.Context) {
 	orderToken := uuid.New().String()
 	var total float64
 	var orderItems []models.OrderItem
+	now := time.Now()
+	campaignsByOwner := map[uint][]models.Campaign{}
 
 	// Start transaction
 	err := database.DB.Transaction(func(tx *gorm.DB) error {
@@ -35,15 +39,50 @@ func CreateOrder(c *gin.Context) {
 			if err := tx.First(&product, itemInput.ProductID).Error; err != nil {
 				return fmt.Errorf("produto não encontrado (ID: %d)", itemInput.ProductID)
 			}
+			if !isPubliclyVisible(&product, now) || inPrivateCollection(tx, &product) {
+				return fmt.Errorf("produto indisponível (ID: %d)", itemInput.ProductID)
+			}
+
+			campaigns, loaded := campaignsByOwner[product.OwnerID]
+			if !loaded {
+				active, err := loadActiveCampaigns(tx, []uint{product.OwnerID}, now)
+				if err != nil {
+					return fmt.Errorf("erro ao calcular preços")
+				}
+				campaigns = active[product.OwnerID]
+				campaignsByOwner[product.OwnerID] = campaigns
+			}
+			price := effectivePrice(&product, campaigns, now)
+
+			// The buyer gets the image shown in the catalog, watermark included.
+			if err := tx.Where("product_id = ?", product.ID).Order("position asc, id asc").Find(&product.Images).Error; err != nil {
+				return fmt.Errorf("erro ao carregar imagens")
+			}
+			public := []models.Product{product}
+			if err := preparePublicProducts(public); err != nil {
+				return fmt.Errorf("erro ao carregar imagens")
+			}
+			imageURL := ""
+			if public[0].ImageURL != nil {
+				imageURL = *public[0].ImageURL
+			}
+			sku := ""
+			if product.SKU != nil {
+				sku = *product.SKU
+			}
 
 			orderItem := models.OrderItem{
-				ProductID: &product.ID,
-				Quantity:  itemInput.Quantity,
-				Size:      itemInput.Size,
-				Price:     product.Price,
+				ProductID:   &product.ID,
+				OwnerID:     &product.OwnerID,
+				Quantity:    itemInput.Quantity,
+				Size:        itemInput.Size,
+				Price:       price,
+				ProductName: product.Name,
+				ProductSKU:  sku,
+				ImageURL:    imageURL,
 			}
 			orderItems = append(orderItems, orderItem)
-			total += product.Price * float64(itemInput.Quantity)
+			total += price * float64(itemInput.Quantity)
 		}
 
 		order := models.Order{
@@ -72,3 +111,44 @@ func CreateOrder(c *gin.Context) {
 		"total":       total,
 	})
 }
+
+// GetOrderByToken shows an order to whoever holds its public token, using the
+// item snapshots rather than the current products.
+func GetOrderByToken(c *gin.Context) {
+	token := c.Param("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token inválido"})
+		return
+	}
+
+	var order models.Order
+	if err := database.DB.Preload("Items").Where("order_token = ?", token).First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pedido não encontrado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar pedido"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func GetMyOrders(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// An order can hold products of several stores; each store only sees
+	// its own items.
+	var orders []models.Order
+	ownerItems := database.DB.Model(&models.OrderItem{}).Select("order_id").Where("owner_id = ?", ownerID)
+	if err := database.DB.Preload("Items", "owner_id = ?", ownerID).Where("id IN (?)", ownerItems).Order("created_at desc").Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar pedidos"})
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
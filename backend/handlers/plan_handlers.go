@@ -5,6 +5,7 @@ import (
 
 	"github.com/FelippeTN/Web-Catalogo/backend/database"
 	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -41,14 +42,16 @@ func GetMyPlanInfo(c *gin.Context) {
 		user.Plan = &freePlan
 	}
 
-	var productCount int64
-	database.DB.Model(&models.Product{}).Where("owner_id = ?", ownerID).Count(&productCount)
+	productCount := countPlanProducts(ownerID)
 
 	var collectionCount int64
 	database.DB.Model(&models.Collection{}).Where("owner_id = ?", ownerID).Count(&collectionCount)
 
+	storageUsed := storageUsedBytes(ownerID)
+
 	canCreateProduct := user.Plan.MaxProducts == -1 || int(productCount) < user.Plan.MaxProducts
 	canCreateCollection := user.Plan.MaxCollections == -1 || int(collectionCount) < user.Plan.MaxCollections
+	canUploadImages := user.Plan.MaxStorageBytes == -1 || storageUsed < user.Plan.MaxStorageBytes
 
 	planInfo := models.UserPlanInfo{
 		Plan:                *user.Plan,
@@ -56,6 +59,8 @@ func GetMyPlanInfo(c *gin.Context) {
 		CollectionCount:     int(collectionCount),
 		CanCreateProduct:    canCreateProduct,
 		CanCreateCollection: canCreateCollection,
+		StorageUsedBytes:    storageUsed,
+		CanUploadImages:     canUploadImages,
 		SubscriptionStatus:  user.SubscriptionStatus,
 		PlanExpiresAt:       user.PlanExpiresAt,
 	}
@@ -63,6 +68,116 @@ func GetMyPlanInfo(c *gin.Context) {
 	c.JSON(http.StatusOK, planInfo)
 }
 
+// countPlanProducts counts the products that use a slot of the owner's plan;
+// archived products are kept out of the count.
+func countPlanProducts(ownerID uint) int64 {
+	var productCount int64
+	database.DB.Model(&models.Product{}).
+		Where("owner_id = ? AND status <> ?", ownerID, models.ProductStatusArchived).
+		Count(&productCount)
+	return productCount
+}
+
+// storageUsedBytes adds up the image files (trashed products included, since
+// their files are kept until purged) and the logo of an owner. Files are
+// stored by content, so each distinct image_url counts once however many
+// products use it; a duplicated product adds nothing.
+func storageUsedBytes(ownerID uint) int64 {
+	files := database.DB.Model(&models.ProductImage{}).
+		Joins("JOIN products ON products.id = product_images.product_id").
+		Where("products.owner_id = ?", ownerID).
+		Group("product_images.image_url").
+		Select("MAX(product_images.size_bytes) AS size_bytes")
+
+	var imageBytes int64
+	database.DB.Table("(?) AS files", files).
+		Select("COALESCE(SUM(size_bytes), 0)").
+		Scan(&imageBytes)
+
+	var logoBytes int64
+	database.DB.Model(&models.User{}).Where("id = ?", ownerID).Select("logo_size_bytes").Scan(&logoBytes)
+
+	return imageBytes + logoBytes
+}
+
+// newImageBytes returns what the image files at urls add to the owner's
+// storage, counting each file once and skipping those the owner's products
+// already use, as storageUsedBytes does.
+func newImageBytes(ownerID uint, urls []string) (int64, error) {
+	var used []string
+	if len(urls) > 0 {
+		if err := database.DB.Model(&models.ProductImage{}).
+			Joins("JOIN products ON products.id = product_images.product_id").
+			Where("products.owner_id = ? AND product_images.image_url IN ?", ownerID, urls).
+			Distinct().Pluck("product_images.image_url", &used).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	counted := map[string]bool{}
+	for _, url := range used {
+		counted[url] = true
+	}
+	var total int64
+	for _, url := range urls {
+		if counted[url] {
+			continue
+		}
+		counted[url] = true
+		size, _ := utils.UploadSize(url)
+		total += size
+	}
+	return total, nil
+}
+
+// CheckStorageLimit returns how many bytes the owner can still store, or -1
+// when the plan has no storage limit.
+func CheckStorageLimit(ownerID uint) (int64, *models.Plan, int64, error) {
+	var user models.User
+	if err := database.DB.Preload("Plan").First(&user, ownerID).Error; err != nil {
+		return 0, nil, 0, err
+	}
+
+	if user.Plan == nil {
+		var freePlan models.Plan
+		if err := database.DB.Where("name = ?", "free").First(&freePlan).Error; err != nil {
+			return 0, nil, 0, err
+		}
+		user.Plan = &freePlan
+	}
+
+	used := storageUsedBytes(ownerID)
+	if user.Plan.MaxStorageBytes == -1 {
+		return -1, user.Plan, used, nil
+	}
+	return max(0, user.Plan.MaxStorageBytes-used), user.Plan, used, nil
+}
+
+// checkStorageFits responds with 403 and returns false when size bytes
+// don't fit in the storage left on the owner's plan.
+func checkStorageFits(c *gin.Context, ownerID uint, size int64) bool {
+	remaining, plan, used, err := CheckStorageLimit(ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+		return false
+	}
+	if remaining != -1 && size > remaining {
+		respondStorageLimit(c, plan, used)
+		return false
+	}
+	return true
+}
+
+func respondStorageLimit(c *gin.Context, plan *models.Plan, used int64) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":            "Storage limit reached",
+		"limit":            plan.MaxStorageBytes,
+		"current_usage":    used,
+		"plan_name":        plan.DisplayName,
+		"upgrade_required": true,
+	})
+}
+
 func CheckProductLimit(ownerID uint) (bool, *models.Plan, int, error) {
 	var user models.User
 	if err := database.DB.Preload("Plan").First(&user, ownerID).Error; err != nil {
@@ -77,8 +192,7 @@ func CheckProductLimit(ownerID uint) (bool, *models.Plan, int, error) {
 		user.Plan = &freePlan
 	}
 
-	var productCount int64
-	database.DB.Model(&models.Product{}).Where("owner_id = ?", ownerID).Count(&productCount)
+	productCount := countPlanProducts(ownerID)
 
 	canCreate := user.Plan.MaxProducts == -1 || int(productCount) < user.Plan.MaxProducts
 	return canCreate, user.Plan, int(productCount), nil
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"gorm.io/gorm"
+)
+
+// loadActiveCampaigns returns the campaigns of the given owners that are
+// running at the given time, grouped by owner.
+func loadActiveCampaigns(db *gorm.DB, ownerIDs []uint, now time.Time) (map[uint][]models.Campaign, error) {
+	byOwner := map[uint][]models.Campaign{}
+	if len(ownerIDs) == 0 {
+		return byOwner, nil
+	}
+
+	var campaigns []models.Campaign
+	err := db.Where("owner_id IN ? AND is_active = ?", ownerIDs, true).
+		Where("starts_at IS NULL OR starts_at <= ?", now).
+		Where("ends_at IS NULL OR ends_at > ?", now).
+		Find(&campaigns).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, campaign := range campaigns {
+		byOwner[campaign.OwnerID] = append(byOwner[campaign.OwnerID], campaign)
+	}
+	return byOwner, nil
+}
+
+// effectivePrice returns the price a customer pays for the product right now:
+// the lowest of the base price, the scheduled sale price and the best campaign
+// discount covering the product.
+func effectivePrice(product *models.Product, campaigns []models.Campaign, now time.Time) float64 {
+	price := product.Price
+
+	if product.SalePrice != nil && saleIsActive(product, now) && *product.SalePrice < price {
+		price = *product.SalePrice
+	}
+
+	var bestDiscount float64
+	for _, campaign := range campaigns {
+		if campaign.CollectionID != nil && (product.CollectionID == nil || *campaign.CollectionID != *product.CollectionID) {
+			continue
+		}
+		if campaign.DiscountPercent > bestDiscount {
+			bestDiscount = campaign.DiscountPercent
+		}
+	}
+	if bestDiscount > 0 {
+		discounted := product.Price * (1 - bestDiscount/100)
+		if discounted < price {
+			price = discounted
+		}
+	}
+
+	return math.Round(price*100) / 100
+}
+
+func saleIsActive(product *models.Product, now time.Time) bool {
+	if product.SaleStartsAt != nil && now.Before(*product.SaleStartsAt) {
+		return false
+	}
+	if product.SaleEndsAt != nil && !now.Before(*product.SaleEndsAt) {
+		return false
+	}
+	return true
+}
+
+// applyPricing fills the computed CurrentPrice and OnSale fields of products.
+func applyPricing(products []models.Product) error {
+	now := time.Now()
+
+	ownerSet := map[uint]struct{}{}
+	var ownerIDs []uint
+	for _, product := range products {
+		if _, seen := ownerSet[product.OwnerID]; !seen {
+			ownerSet[product.OwnerID] = struct{}{}
+			ownerIDs = append(ownerIDs, product.OwnerID)
+		}
+	}
+
+	campaigns, err := loadActiveCampaigns(database.DB, ownerIDs, now)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		products[i].CurrentPrice = effectivePrice(&products[i], campaigns[products[i].OwnerID], now)
+		products[i].OnSale = products[i].CurrentPrice < products[i].Price
+	}
+	return nil
+}
+
+// applyProductPricing is applyPricing for a single product.
+func applyProductPricing(product *models.Product) error {
+	products := []models.Product{*product}
+	if err := applyPricing(products); err != nil {
+		return err
+	}
+	product.CurrentPrice = products[0].CurrentPrice
+	product.OnSale = products[0].OnSale
+	return nil
+}
+
+// validatePricing checks the promotional fields against the base price.
+func validatePricing(price float64, compareAtPrice, salePrice *float64, saleStartsAt, saleEndsAt *time.Time) error {
+	if price <= 0 {
+		return errors.New("price must be greater than zero")
+	}
+	if compareAtPrice != nil && *compareAtPrice <= price {
+		return errors.New("compare_at_price must be greater than price")
+	}
+	if salePrice != nil && (*salePrice <= 0 || *salePrice >= price) {
+		return errors.New("sale_price must be greater than zero and lower than price")
+	}
+	if saleStartsAt != nil && saleEndsAt != nil && !saleEndsAt.After(*saleStartsAt) {
+		return errors.New("sale_ends_at must be after sale_starts_at")
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxSKULength = 64
+
+var errSKUInUse = errors.New("SKU already used by another product")
+
+// normalizeCode trims a SKU or barcode, mapping empty values to nil.
+func normalizeCode(code *string) *string {
+	if code == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*code)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+// validateCatalogFields checks SKU, barcode, weight and dimensions of a
+// product about to be saved, including SKU uniqueness within the store.
+func validateCatalogFields(db *gorm.DB, product *models.Product) error {
+	if product.SKU != nil && len(*product.SKU) > maxSKULength {
+		return errors.New("SKU is too long")
+	}
+	if product.Barcode != nil && !utils.IsValidGTIN(*product.Barcode) {
+		return errors.New("Invalid barcode")
+	}
+	if product.WeightGrams != nil && *product.WeightGrams < 0 {
+		return errors.New("weight_grams must be positive")
+	}
+	for _, dimension := range []*float64{product.LengthCm, product.WidthCm, product.HeightCm} {
+		if dimension != nil && *dimension < 0 {
+			return errors.New("dimensions must be positive")
+		}
+	}
+
+	if product.SKU != nil {
+		taken, err := skuInUse(db, product.OwnerID, *product.SKU, product.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errSKUInUse
+		}
+	}
+	return nil
+}
+
+func skuInUse(db *gorm.DB, ownerID uint, sku string, excludeID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.Product{}).
+		Where("owner_id = ? AND sku = ? AND id <> ?", ownerID, sku, excludeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// respondCatalogError maps validateCatalogFields errors to a response.
+func respondCatalogError(c *gin.Context, err error) {
+	if errors.Is(err, errSKUInUse) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+func positiveIntOrNil(value *int) *int {
+	if value == nil || *value == 0 {
+		return nil
+	}
+	return value
+}
+
+func positiveFloatOrNil(value *float64) *float64 {
+	if value == nil || *value == 0 {
+		return nil
+	}
+	return value
+}
+
+// mergeCatalogInput applies the catalogue fields of input onto product and
+// returns the matching column updates.
+func mergeCatalogInput(product *models.Product, input *models.UpdateProductInput) map[string]any {
+	updates := map[string]any{}
+
+	if input.SKU != nil {
+		product.SKU = normalizeCode(input.SKU)
+		updates["sku"] = product.SKU
+	}
+	if input.Barcode != nil {
+		product.Barcode = normalizeCode(input.Barcode)
+		updates["barcode"] = product.Barcode
+	}
+	if input.WeightGrams != nil {
+		product.WeightGrams = positiveIntOrNil(input.WeightGrams)
+		updates["weight_grams"] = product.WeightGrams
+	}
+	if input.LengthCm != nil {
+		product.LengthCm = positiveFloatOrNil(input.LengthCm)
+		updates["length_cm"] = product.LengthCm
+	}
+	if input.WidthCm != nil {
+		product.WidthCm = positiveFloatOrNil(input.WidthCm)
+		updates["width_cm"] = product.WidthCm
+	}
+	if input.HeightCm != nil {
+		product.HeightCm = positiveFloatOrNil(input.HeightCm)
+		updates["height_cm"] = product.HeightCm
+	}
+
+	return updates
+}
+
+// LookupProduct finds one of the owner's products by exact SKU or barcode.
+func LookupProduct(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	sku := strings.TrimSpace(c.Query("sku"))
+	barcode := strings.TrimSpace(c.Query("barcode"))
+	if sku == "" && barcode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sku or barcode is required"})
+		return
+	}
+
+	query := database.DB.Scopes(withProductRelations).Where("owner_id = ?", ownerID)
+	if sku != "" {
+		query = query.Where("sku = ?", sku)
+	}
+	if barcode != "" {
+		query = query.Where("barcode = ?", barcode)
+	}
+
+	var product models.Product
+	if err := query.First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve product"})
+		return
+	}
+	if err := applyProductPricing(&product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not compute prices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
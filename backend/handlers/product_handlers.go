@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/FelippeTN/Web-Catalogo/backend/config"
 	"github.com/FelippeTN/Web-Catalogo/backend/database"
 	"github.com/FelippeTN/Web-Catalogo/backend/models"
 	"github.com/FelippeTN/Web-Catalogo/backend/utils"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func CreateProduct(c *gin.Context) {
@@ -40,8 +44,56 @@ func CreateProduct(c *gin.Context) {
 		return
 	}
 
+	if err := validatePricing(input.Price, input.CompareAtPrice, input.SalePrice, input.SaleStartsAt, input.SaleEndsAt); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Stock != nil && *input.Stock < 0 {
+		input.Stock = nil
+	}
+
+	status := input.Status
+	if status == "" {
+		status = models.ProductStatusPublished
+	}
+	if err := validateProductSchedule(status, input.PublishAt, input.UnpublishAt); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	catalog := models.Product{
+		OwnerID:     ownerID,
+		SKU:         normalizeCode(input.SKU),
+		Barcode:     normalizeCode(input.Barcode),
+		WeightGrams: positiveIntOrNil(input.WeightGrams),
+		LengthCm:    positiveFloatOrNil(input.LengthCm),
+		WidthCm:     positiveFloatOrNil(input.WidthCm),
+		HeightCm:    positiveFloatOrNil(input.HeightCm),
+	}
+	if err := validateCatalogFields(database.DB, &catalog); err != nil {
+		respondCatalogError(c, err)
+		return
+	}
+
+	attributeValues, err := parseAttributeValues(ownerID, input.Attributes, true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	remainingStorage, _, storageUsed, err := CheckStorageLimit(ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+		return
+	}
+
 	// Upload images using shared utility
-	uploadedImages, err := utils.UploadImages(c, "images", config.MaxImagesPerProduct, config.MaxImageSize)
+	uploadedImages, err := utils.UploadImages(c, "images", plan.MaxImagesPerProduct, config.MaxImageSize, remainingStorage)
+	if errors.Is(err, utils.ErrStorageQuotaExceeded) {
+		respondStorageLimit(c, plan, storageUsed)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -67,24 +119,58 @@ func CreateProduct(c *gin.Context) {
 		Description:  input.Description,
 		Price:        input.Price,
 		Sizes:        input.Sizes,
+		Tags:         normalizeTags(splitTags(input.Tags)),
+		Stock:        input.Stock,
 		ImageURL:     mainImageURL,
+
+		SKU:         catalog.SKU,
+		Barcode:     catalog.Barcode,
+		WeightGrams: catalog.WeightGrams,
+		LengthCm:    catalog.LengthCm,
+		WidthCm:     catalog.WidthCm,
+		HeightCm:    catalog.HeightCm,
+
+		Status:      status,
+		PublishAt:   input.PublishAt,
+		UnpublishAt: input.UnpublishAt,
+
+		CompareAtPrice: input.CompareAtPrice,
+		SalePrice:      input.SalePrice,
+		SaleStartsAt:   input.SaleStartsAt,
+		SaleEndsAt:     input.SaleEndsAt,
 	}
 
-	if err := database.DB.Create(&product).Error; err != nil {
+	images := newProductImages(uploadedImages)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&product).Error; err != nil {
+			return err
+		}
+		if err := createProductImages(tx, product.ID, images); err != nil {
+			return err
+		}
+		if err := saveAttributeValues(tx, product.ID, attributeValues); err != nil {
+			return err
+		}
+		if err := tx.Scopes(withProductRelations).First(&product, product.ID).Error; err != nil {
+			return err
+		}
+		return recordProductRevision(tx, models.RevisionActionCreate, nil, &product, ownerID)
+	})
+	if err != nil {
+		if errors.Is(err, errAttributeOptionGone) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create product"})
 		return
 	}
-
-	for i, imgURL := range uploadedImages {
-		productImage := models.ProductImage{
-			ProductID: product.ID,
-			ImageURL:  imgURL,
-			Position:  i,
-		}
-		database.DB.Create(&productImage)
+	if len(uploadedImages) > 0 {
+		syncWatermarksAsync(ownerID)
+	}
+	if err := applyProductPricing(&product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not compute prices"})
+		return
 	}
-
-	database.DB.Preload("Images").First(&product, product.ID)
 
 	c.JSON(http.StatusCreated, product)
 }
@@ -92,7 +178,7 @@ func CreateProduct(c *gin.Context) {
 func GetProducts(c *gin.Context) {
 	var products []models.Product
 
-	query := database.DB.Model(&models.Product{}).Preload("Images")
+	query := database.DB.Model(&models.Product{}).Scopes(withProductRelations).Scopes(publiclyVisible(time.Now()), inPublicCollection)
 	if ownerIDRaw := c.Query("owner_id"); ownerIDRaw != "" {
 		ownerIDParsed, err := strconv.ParseUint(ownerIDRaw, 10, 64)
 		if err != nil {
@@ -109,11 +195,22 @@ func GetProducts(c *gin.Context) {
 		}
 		query = query.Where("collection_id = ?", uint(collectionIDParsed))
 	}
+	if attributeFilters := c.QueryMap("attr"); len(attributeFilters) > 0 {
+		query = filterByAttributes(query, attributeFilters)
+	}
 
 	if err := query.Order("created_at desc").Find(&products).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve products"})
 		return
 	}
+	if err := applyPricing(products); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not compute prices"})
+		return
+	}
+	if err := preparePublicProducts(products); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve products"})
+		return
+	}
 
 	c.JSON(http.StatusOK, products)
 }
@@ -126,10 +223,14 @@ func GetMyProducts(c *gin.Context) {
 	}
 
 	var products []models.Product
-	if err := database.DB.Preload("Images").Where("owner_id = ?", ownerID).Order("created_at desc").Find(&products).Error; err != nil {
+	if err := database.DB.Scopes(withProductRelations).Where("owner_id = ?", ownerID).Order("created_at desc").Find(&products).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve products"})
 		return
 	}
+	if err := applyPricing(products); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not compute prices"})
+		return
+	}
 
 	c.JSON(http.StatusOK, products)
 }
@@ -153,6 +254,65 @@ func UpdateProduct(c *gin.Context) {
 		return
 	}
 
+	var existing models.Product
+	if err := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&existing).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve product"})
+		return
+	}
+
+	before := existing
+	wasArchived := existing.Status == models.ProductStatusArchived
+	pricingUpdates := mergePricingInput(&existing, &input)
+	if err := validatePricing(existing.Price, existing.CompareAtPrice, existing.SalePrice, existing.SaleStartsAt, existing.SaleEndsAt); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	statusUpdates := mergeStatusInput(&existing, &input)
+	if err := validateProductSchedule(existing.Status, existing.PublishAt, existing.UnpublishAt); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	catalogUpdates := mergeCatalogInput(&existing, &input)
+	if err := validateCatalogFields(database.DB, &existing); err != nil {
+		respondCatalogError(c, err)
+		return
+	}
+
+	var attributeValues map[uint]string
+	if input.Attributes != nil {
+		attributeValues, err = parseAttributeValues(ownerID, *input.Attributes, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Archived products don't count toward the plan, so bringing one back
+	// needs a free slot.
+	if wasArchived && existing.Status != models.ProductStatusArchived {
+		canCreate, plan, currentCount, err := CheckProductLimit(ownerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+			return
+		}
+		if !canCreate {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":            "Product limit reached",
+				"limit":            plan.MaxProducts,
+				"current_count":    currentCount,
+				"plan_name":        plan.DisplayName,
+				"upgrade_required": true,
+			})
+			return
+		}
+	}
+
 	// Handle image deletions
 	deleteImageIDsStr := c.PostFormArray("delete_image_ids")
 	var deleteImageIDs []uint
@@ -163,26 +323,42 @@ func UpdateProduct(c *gin.Context) {
 		}
 	}
 
+	// The images are deleted along with the other changes, once the checks
+	// below have passed
+	var deletedImages []models.ProductImage
 	if len(deleteImageIDs) > 0 {
-		database.DB.Where("id IN ? AND product_id = ?", deleteImageIDs, uint(id)).Delete(&models.ProductImage{})
+		if err := database.DB.Where("id IN ? AND product_id = ?", deleteImageIDs, uint(id)).Find(&deletedImages).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve images"})
+			return
+		}
 	}
 
 	// Count existing images (minus deletions)
 	var existingImageCount int64
-	database.DB.Model(&models.ProductImage{}).Where("product_id = ?", uint(id)).Count(&existingImageCount)
-	existingImageCount -= int64(len(deleteImageIDs))
-	if existingImageCount < 0 {
-		existingImageCount = 0
+	if err := database.DB.Model(&models.ProductImage{}).Where("product_id = ?", uint(id)).Count(&existingImageCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve images"})
+		return
+	}
+	existingImageCount -= int64(len(deletedImages))
+
+	remainingStorage, plan, storageUsed, err := CheckStorageLimit(ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+		return
 	}
 
 	// Calculate remaining slots for new images
-	remainingSlots := config.MaxImagesPerProduct - int(existingImageCount)
-	if remainingSlots < 0 {
-		remainingSlots = 0
+	remainingSlots := -1
+	if plan.MaxImagesPerProduct != -1 {
+		remainingSlots = max(0, plan.MaxImagesPerProduct-int(existingImageCount))
 	}
 
 	// Upload new images using shared utility
-	uploadedImages, err := utils.UploadImages(c, "images", remainingSlots, config.MaxImageSize)
+	uploadedImages, err := utils.UploadImages(c, "images", remainingSlots, config.MaxImageSize, remainingStorage)
+	if errors.Is(err, utils.ErrStorageQuotaExceeded) {
+		respondStorageLimit(c, plan, storageUsed)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -192,56 +368,101 @@ func UpdateProduct(c *gin.Context) {
 	var maxPosition int
 	database.DB.Model(&models.ProductImage{}).Where("product_id = ?", uint(id)).Select("COALESCE(MAX(position), -1)").Scan(&maxPosition)
 
-	for i, imgURL := range uploadedImages {
-		productImage := models.ProductImage{
-			ProductID: uint(id),
-			ImageURL:  imgURL,
-			Position:  maxPosition + 1 + i,
-		}
-		database.DB.Create(&productImage)
+	newImages := newProductImages(uploadedImages)
+	for i := range newImages {
+		newImages[i].Position = maxPosition + 1 + i
 	}
 
 	// Build updates map
-	updates := map[string]any{}
+	updates := pricingUpdates
+	for column, value := range statusUpdates {
+		updates[column] = value
+	}
+	for column, value := range catalogUpdates {
+		updates[column] = value
+	}
 	if input.Name != nil {
 		updates["name"] = *input.Name
 	}
 	if input.Description != nil {
 		updates["description"] = *input.Description
 	}
-	if input.Price != nil {
-		updates["price"] = *input.Price
-	}
 	if input.Sizes != nil {
 		updates["sizes"] = *input.Sizes
 	}
+	if input.Tags != nil {
+		updates["tags"] = normalizeTags(splitTags(*input.Tags))
+	}
+	if input.Stock != nil {
+		if *input.Stock < 0 {
+			updates["stock"] = nil
+		} else {
+			updates["stock"] = *input.Stock
+		}
+	}
 	if input.CollectionID != nil {
 		updates["collection_id"] = *input.CollectionID
 	}
 
-	// Update main image_url to first image
-	var firstImage models.ProductImage
-	if err := database.DB.Where("product_id = ?", uint(id)).Order("position asc").First(&firstImage).Error; err == nil {
-		updates["image_url"] = firstImage.ImageURL
-	}
+	var updated models.Product
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(deletedImages) > 0 {
+			if err := tx.Delete(&deletedImages).Error; err != nil {
+				return err
+			}
+			if err := releaseImageFiles(tx, deletedImages); err != nil {
+				return err
+			}
+		}
+		if err := createProductImages(tx, uint(id), newImages); err != nil {
+			return err
+		}
 
-	if len(updates) > 0 {
-		result := database.DB.Model(&models.Product{}).
-			Where("id = ? AND owner_id = ?", uint(id), ownerID).
-			Updates(updates)
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update product"})
-			return
+		// Update main image_url to first image
+		var firstImage models.ProductImage
+		if err := tx.Where("product_id = ?", uint(id)).Order("position asc").First(&firstImage).Error; err == nil {
+			updates["image_url"] = firstImage.ImageURL
+		} else if len(deletedImages) > 0 {
+			updates["image_url"] = nil
 		}
-		if result.RowsAffected == 0 {
+
+		if len(updates) > 0 {
+			result := tx.Model(&models.Product{}).
+				Where("id = ? AND owner_id = ?", uint(id), ownerID).
+				Updates(updates)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+		}
+
+		if err := saveAttributeValues(tx, uint(id), attributeValues); err != nil {
+			return err
+		}
+		if err := tx.Scopes(withProductRelations).Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&updated).Error; err != nil {
+			return err
+		}
+		return recordProductRevision(tx, models.RevisionActionUpdate, &before, &updated, ownerID)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
 		}
+		if errors.Is(err, errAttributeOptionGone) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update product"})
+		return
 	}
-
-	var updated models.Product
-	if err := database.DB.Preload("Images").Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&updated).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve updated product"})
+	if len(uploadedImages) > 0 {
+		syncWatermarksAsync(ownerID)
+	}
+	if err := applyProductPricing(&updated); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not compute prices"})
 		return
 	}
 
@@ -261,17 +482,122 @@ func DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	database.DB.Where("product_id = ?", uint(id)).Delete(&models.ProductImage{})
-
-	result := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).Delete(&models.Product{})
-	if result.Error != nil {
+	// Soft delete: the product goes to the trash with its images and is purged
+	// by PurgeTrash once the retention period is over.
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&product).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&product).Error; err != nil {
+			return err
+		}
+		return recordProductRevision(tx, models.RevisionActionDelete, &product, &product, ownerID)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete product"})
 		return
 	}
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-		return
-	}
 
 	c.Status(http.StatusNoContent)
 }
+
+// mergePricingInput applies the pricing fields of input onto product so the
+// result can be validated, and returns the matching column updates.
+func mergePricingInput(product *models.Product, input *models.UpdateProductInput) map[string]any {
+	updates := map[string]any{}
+
+	if input.Price != nil {
+		product.Price = *input.Price
+		updates["price"] = *input.Price
+	}
+	if input.CompareAtPrice != nil {
+		if *input.CompareAtPrice == 0 {
+			product.CompareAtPrice = nil
+		} else {
+			product.CompareAtPrice = input.CompareAtPrice
+		}
+		updates["compare_at_price"] = product.CompareAtPrice
+	}
+	if input.SaleStartsAt != nil {
+		product.SaleStartsAt = input.SaleStartsAt
+		updates["sale_starts_at"] = product.SaleStartsAt
+	}
+	if input.SaleEndsAt != nil {
+		product.SaleEndsAt = input.SaleEndsAt
+		updates["sale_ends_at"] = product.SaleEndsAt
+	}
+	if input.SalePrice != nil {
+		if *input.SalePrice == 0 {
+			product.SalePrice = nil
+			product.SaleStartsAt = nil
+			product.SaleEndsAt = nil
+			updates["sale_starts_at"] = nil
+			updates["sale_ends_at"] = nil
+		} else {
+			product.SalePrice = input.SalePrice
+		}
+		updates["sale_price"] = product.SalePrice
+	}
+
+	return updates
+}
+
+// mergeStatusInput applies the status and schedule fields of input onto
+// product and returns the matching column updates.
+func mergeStatusInput(product *models.Product, input *models.UpdateProductInput) map[string]any {
+	updates := map[string]any{}
+
+	if input.Status != nil {
+		product.Status = *input.Status
+		updates["status"] = *input.Status
+	}
+	if input.ClearSchedule {
+		product.PublishAt = nil
+		product.UnpublishAt = nil
+		updates["publish_at"] = nil
+		updates["unpublish_at"] = nil
+	}
+	if input.PublishAt != nil {
+		product.PublishAt = input.PublishAt
+		updates["publish_at"] = input.PublishAt
+	}
+	if input.UnpublishAt != nil {
+		product.UnpublishAt = input.UnpublishAt
+		updates["unpublish_at"] = input.UnpublishAt
+	}
+
+	return updates
+}
+
+func splitTags(raw string) []string {
+	return strings.Split(raw, ",")
+}
+
+// normalizeTags trims and de-duplicates tags (case-insensitively) and joins
+// them in the comma-separated form stored on the product.
+func normalizeTags(tags []string) string {
+	seen := map[string]bool{}
+	var result []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, tag)
+	}
+	return strings.Join(result, ",")
+}
+
+// withProductRelations preloads what every product response carries.
+func withProductRelations(db *gorm.DB) *gorm.DB {
+	return db.Preload("Images", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc, id asc")
+	}).Preload("Attributes.Attribute")
+}
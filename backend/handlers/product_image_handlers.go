@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxAltTextLength = 250
+
+var errInvalidImageOrder = errors.New("image_ids must list every image of the product once")
+
+// ReorderProductImages sets the order of a product's images. The first image
+// becomes the main one.
+func ReorderProductImages(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var input models.ReorderProductImagesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	product, ok := findOwnedProduct(c, uint(id), ownerID)
+	if !ok {
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var images []models.ProductImage
+		if err := tx.Where("product_id = ?", product.ID).Find(&images).Error; err != nil {
+			return err
+		}
+		if len(images) != len(input.ImageIDs) {
+			return errInvalidImageOrder
+		}
+		byID := map[uint]models.ProductImage{}
+		for _, image := range images {
+			byID[image.ID] = image
+		}
+		ordered := make([]models.ProductImage, 0, len(images))
+		for _, imageID := range input.ImageIDs {
+			image, ok := byID[imageID]
+			if !ok {
+				return errInvalidImageOrder
+			}
+			delete(byID, imageID)
+			ordered = append(ordered, image)
+		}
+		return saveImageOrder(tx, product.ID, ordered)
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidImageOrder) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not reorder images"})
+		return
+	}
+
+	respondProductImages(c, product.ID)
+}
+
+// SetMainProductImage moves an image to the front, keeping the relative order
+// of the others.
+func SetMainProductImage(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+	imageID, err := strconv.ParseUint(c.Param("imageId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image id"})
+		return
+	}
+
+	product, ok := findOwnedProduct(c, uint(id), ownerID)
+	if !ok {
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var images []models.ProductImage
+		if err := tx.Where("product_id = ?", product.ID).Order("position asc, id asc").Find(&images).Error; err != nil {
+			return err
+		}
+		ordered := make([]models.ProductImage, 0, len(images))
+		for _, image := range images {
+			if image.ID == uint(imageID) {
+				ordered = append([]models.ProductImage{image}, ordered...)
+			} else {
+				ordered = append(ordered, image)
+			}
+		}
+		if len(ordered) == 0 || ordered[0].ID != uint(imageID) {
+			return gorm.ErrRecordNotFound
+		}
+		return saveImageOrder(tx, product.ID, ordered)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not set main image"})
+		return
+	}
+
+	respondProductImages(c, product.ID)
+}
+
+func UpdateProductImage(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+	imageID, err := strconv.ParseUint(c.Param("imageId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image id"})
+		return
+	}
+
+	var input models.UpdateProductImageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if input.AltText == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+	altText := strings.TrimSpace(*input.AltText)
+	if len([]rune(altText)) > maxAltTextLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Alt text too long"})
+		return
+	}
+
+	product, ok := findOwnedProduct(c, uint(id), ownerID)
+	if !ok {
+		return
+	}
+
+	var image models.ProductImage
+	if err := database.DB.Where("id = ? AND product_id = ?", uint(imageID), product.ID).First(&image).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve image"})
+		return
+	}
+
+	if err := database.DB.Model(&image).Update("alt_text", altText).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update image"})
+		return
+	}
+
+	c.JSON(http.StatusOK, image)
+}
+
+// EditProductImage crops, rotates and pads an image to a square. The result
+// is stored as a new file with new variants; the previous file is removed
+// once no image uses it.
+func EditProductImage(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+	imageID, err := strconv.ParseUint(c.Param("imageId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image id"})
+		return
+	}
+
+	var input models.EditProductImageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	edit, err := imageEditFromInput(input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, ok := findOwnedProduct(c, uint(id), ownerID)
+	if !ok {
+		return
+	}
+
+	var image models.ProductImage
+	if err := database.DB.Where("id = ? AND product_id = ?", uint(imageID), product.ID).First(&image).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve image"})
+		return
+	}
+	if image.Status != models.ProductImageReady {
+		c.JSON(http.StatusConflict, gin.H{"error": "Image is still being processed"})
+		return
+	}
+
+	editedURL, err := utils.EditImage(image.ImageURL, edit)
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidImageEdit) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not edit image"})
+		return
+	}
+
+	edited := image
+	edited.ImageURL = editedURL
+	edited.Watermarked = nil
+	edited.WatermarkSignature = ""
+	// Nothing is stored yet; the upload collector removes the edited file.
+	edited.Variants, err = utils.GenerateImageVariants(editedURL)
+	if err != nil {
+		log.Printf("Could not generate variants for %s: %v", editedURL, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not edit image"})
+		return
+	}
+	edited.SizeBytes = storedImageBytes(edited)
+
+	// Files of the edited image may already be shared with other images, so
+	// the ones left unused here are removed by the upload collector.
+	if growth := edited.SizeBytes - image.SizeBytes; growth > 0 && !checkStorageFits(c, ownerID, growth) {
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&edited).Updates(map[string]any{
+			"image_url":           edited.ImageURL,
+			"variants":            edited.Variants,
+			"size_bytes":          edited.SizeBytes,
+			"watermarked":         edited.Watermarked,
+			"watermark_signature": edited.WatermarkSignature,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := models.AddImageFileRef(tx, edited.ImageURL); err != nil {
+			return err
+		}
+		if err := releaseImageFiles(tx, []models.ProductImage{image}); err != nil {
+			return err
+		}
+
+		var images []models.ProductImage
+		if err := tx.Where("product_id = ?", product.ID).Order("position asc, id asc").Find(&images).Error; err != nil {
+			return err
+		}
+		return saveImageOrder(tx, product.ID, images)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update image"})
+		return
+	}
+	syncWatermarksAsync(ownerID)
+
+	c.JSON(http.StatusOK, edited)
+}
+
+// imageEditFromInput validates an edit request; the crop is checked against
+// the image by utils.EditImage.
+func imageEditFromInput(input models.EditProductImageInput) (utils.ImageEdit, error) {
+	edit := utils.ImageEdit{
+		Rotate:     (input.Rotate%360 + 360) % 360,
+		PadSquare:  input.PadSquare,
+		Background: color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+	}
+	if input.Crop != nil {
+		crop := image.Rect(input.Crop.X, input.Crop.Y, input.Crop.X+input.Crop.Width, input.Crop.Y+input.Crop.Height)
+		edit.Crop = &crop
+	}
+	if input.Background != "" {
+		background, err := utils.ParseHexColor(input.Background)
+		if err != nil {
+			return edit, err
+		}
+		edit.Background = background
+	}
+	if edit.Crop == nil && edit.Rotate == 0 && !edit.PadSquare {
+		return edit, errors.New("No changes to apply")
+	}
+	return edit, nil
+}
+
+func findOwnedProduct(c *gin.Context, id, ownerID uint) (models.Product, bool) {
+	var product models.Product
+	if err := database.DB.Where("id = ? AND owner_id = ?", id, ownerID).First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return product, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve product"})
+		return product, false
+	}
+	return product, true
+}
+
+// saveImageOrder renumbers positions from zero and points image_url at the
+// first image.
+func saveImageOrder(tx *gorm.DB, productID uint, ordered []models.ProductImage) error {
+	for i, image := range ordered {
+		if err := tx.Model(&models.ProductImage{}).Where("id = ?", image.ID).Update("position", i).Error; err != nil {
+			return err
+		}
+	}
+	var mainImageURL *string
+	if len(ordered) > 0 {
+		mainImageURL = &ordered[0].ImageURL
+	}
+	return tx.Model(&models.Product{}).Where("id = ?", productID).Update("image_url", mainImageURL).Error
+}
+
+func respondProductImages(c *gin.Context, productID uint) {
+	var images []models.ProductImage
+	if err := database.DB.Where("product_id = ?", productID).Order("position asc, id asc").Find(&images).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve images"})
+		return
+	}
+	c.JSON(http.StatusOK, images)
+}
+
+// newProductImages prepares images for the given uploaded files. An image
+// sharing the file of a processed one reuses its variants; the others are
+// left processing. It queries storage, so it runs before the transaction
+// creating the images rather than inside it.
+func newProductImages(urls []string) []models.ProductImage {
+	images := make([]models.ProductImage, len(urls))
+	for i, url := range urls {
+		var existing models.ProductImage
+		database.DB.Where("image_url = ? AND status = ? AND variants @> '[{}]'::jsonb", url, models.ProductImageReady).
+			Limit(1).Find(&existing)
+
+		image := models.ProductImage{ImageURL: url, Position: i, Variants: existing.Variants, Status: models.ProductImageReady}
+		if len(image.Variants) == 0 {
+			image.Status = models.ProductImageProcessing
+		}
+		image.SizeBytes = storedImageBytes(image)
+		images[i] = image
+	}
+	return images
+}
+
+// createProductImages adds images to a product, counting their references
+// to their files and queueing an ImageJob for those still processing.
+func createProductImages(tx *gorm.DB, productID uint, images []models.ProductImage) error {
+	for i := range images {
+		image := &images[i]
+		image.ProductID = productID
+		if image.Status == "" {
+			image.Status = models.ProductImageReady
+			if len(image.Variants) == 0 {
+				image.Status = models.ProductImageProcessing
+			}
+		}
+		if err := tx.Create(image).Error; err != nil {
+			return err
+		}
+		if err := models.AddImageFileRef(tx, image.ImageURL); err != nil {
+			return err
+		}
+		if image.Status == models.ProductImageProcessing {
+			job := models.ImageJob{ImageID: image.ID, Status: models.ImageJobPending, RunAfter: time.Now()}
+			if err := tx.Create(&job).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// storedImageBytes adds up the sizes of the image file and its variants, or
+// returns the size of the upload while it's processing.
+func storedImageBytes(image models.ProductImage) int64 {
+	size, err := utils.UploadSize(image.ImageURL)
+	if err != nil {
+		size, _ = utils.PendingImageSize(image.ImageURL)
+	}
+	for _, variant := range image.Variants {
+		size += variant.Size
+	}
+	return size
+}
+
+// BackfillImages generates the variants and records the stored size of
+// images uploaded before either existed, and records the size of logos.
+// It's safe to run again: complete records are skipped.
+func BackfillImages() error {
+	var images []models.ProductImage
+	updated, failed := 0, 0
+	err := database.DB.Where("status = ? AND (variants IS NULL OR variants = 'null'::jsonb OR variants = '[]'::jsonb OR size_bytes = 0)", models.ProductImageReady).
+		FindInBatches(&images, 100, func(tx *gorm.DB, batch int) error {
+			for _, image := range images {
+				updates := map[string]any{}
+				if len(image.Variants) == 0 {
+					variants, err := utils.GenerateImageVariants(image.ImageURL)
+					if err != nil {
+						log.Printf("Image %d (%s): %v", image.ID, image.ImageURL, err)
+						failed++
+						continue
+					}
+					image.Variants = variants
+					updates["variants"] = models.ImageVariants(variants)
+				}
+				updates["size_bytes"] = storedImageBytes(image)
+				if err := database.DB.Model(&image).Updates(updates).Error; err != nil {
+					return err
+				}
+				updated++
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+	log.Printf("Image backfill: %d updated, %d failed", updated, failed)
+
+	var users []models.User
+	if err := database.DB.Where("logo_url <> '' AND logo_size_bytes = 0").Find(&users).Error; err != nil {
+		return err
+	}
+	for _, user := range users {
+		size, err := utils.UploadSize(user.LogoURL)
+		if err != nil {
+			log.Printf("Logo of user %d (%s): %v", user.ID, user.LogoURL, err)
+			continue
+		}
+		if err := database.DB.Model(&user).Update("logo_size_bytes", size).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
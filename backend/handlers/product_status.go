@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"gorm.io/gorm"
+)
+
+// publiclyVisible restricts a product query to the products customers may see
+// at the given time: published and inside their publish window.
+func publiclyVisible(now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("products.status = ?", models.ProductStatusPublished).
+			Where("products.publish_at IS NULL OR products.publish_at <= ?", now).
+			Where("products.unpublish_at IS NULL OR products.unpublish_at > ?", now)
+	}
+}
+
+// inPublicCollection restricts a product query to the products of public
+// collections, and to those outside any collection.
+func inPublicCollection(db *gorm.DB) *gorm.DB {
+	return db.Where("products.collection_id IS NULL OR products.collection_id IN (?)",
+		db.Session(&gorm.Session{NewDB: true}).Model(&models.Collection{}).Select("id").Where("visibility = ?", models.CollectionPublic))
+}
+
+// inPrivateCollection reports whether a product belongs to a collection only
+// its owner may see.
+func inPrivateCollection(tx *gorm.DB, product *models.Product) bool {
+	if product.CollectionID == nil {
+		return false
+	}
+	var count int64
+	tx.Model(&models.Collection{}).Where("id = ? AND visibility = ?", *product.CollectionID, models.CollectionPrivate).Count(&count)
+	return count > 0
+}
+
+// isPubliclyVisible is the in-memory counterpart of publiclyVisible.
+func isPubliclyVisible(product *models.Product, now time.Time) bool {
+	if product.Status != models.ProductStatusPublished {
+		return false
+	}
+	if product.PublishAt != nil && now.Before(*product.PublishAt) {
+		return false
+	}
+	if product.UnpublishAt != nil && !now.Before(*product.UnpublishAt) {
+		return false
+	}
+	return true
+}
+
+func validateProductSchedule(status string, publishAt, unpublishAt *time.Time) error {
+	if !models.IsValidProductStatus(status) {
+		return errors.New("Invalid status")
+	}
+	if publishAt != nil && unpublishAt != nil && !unpublishAt.After(*publishAt) {
+		return errors.New("unpublish_at must be after publish_at")
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func snapshotProduct(product *models.Product) models.ProductSnapshot {
+	return models.ProductSnapshot{
+		Name:           product.Name,
+		Description:    product.Description,
+		Price:          product.Price,
+		CompareAtPrice: product.CompareAtPrice,
+		SalePrice:      product.SalePrice,
+		SaleStartsAt:   product.SaleStartsAt,
+		SaleEndsAt:     product.SaleEndsAt,
+		Sizes:          product.Sizes,
+		Tags:           product.Tags,
+		Stock:          product.Stock,
+		SKU:            product.SKU,
+		Barcode:        product.Barcode,
+		WeightGrams:    product.WeightGrams,
+		LengthCm:       product.LengthCm,
+		WidthCm:        product.WidthCm,
+		HeightCm:       product.HeightCm,
+		Status:         product.Status,
+		PublishAt:      product.PublishAt,
+		UnpublishAt:    product.UnpublishAt,
+		CollectionID:   product.CollectionID,
+	}
+}
+
+// snapshotColumns returns the column updates that bring a product back to
+// the state recorded in snapshot. Stock is left out: it follows the goods
+// on hand rather than the listing, and restoring an old count could oversell.
+func snapshotColumns(snapshot models.ProductSnapshot) map[string]any {
+	return map[string]any{
+		"name":             snapshot.Name,
+		"description":      snapshot.Description,
+		"price":            snapshot.Price,
+		"compare_at_price": snapshot.CompareAtPrice,
+		"sale_price":       snapshot.SalePrice,
+		"sale_starts_at":   snapshot.SaleStartsAt,
+		"sale_ends_at":     snapshot.SaleEndsAt,
+		"sizes":            snapshot.Sizes,
+		"tags":             snapshot.Tags,
+		"sku":              snapshot.SKU,
+		"barcode":          snapshot.Barcode,
+		"weight_grams":     snapshot.WeightGrams,
+		"length_cm":        snapshot.LengthCm,
+		"width_cm":         snapshot.WidthCm,
+		"height_cm":        snapshot.HeightCm,
+		"status":           snapshot.Status,
+		"publish_at":       snapshot.PublishAt,
+		"unpublish_at":     snapshot.UnpublishAt,
+		"collection_id":    snapshot.CollectionID,
+	}
+}
+
+// diffSnapshots compares two snapshots field by field through their JSON
+// form. A nil before means every field is new.
+func diffSnapshots(before *models.ProductSnapshot, after models.ProductSnapshot) models.RevisionChanges {
+	oldFields := map[string]any{}
+	if before != nil {
+		data, _ := json.Marshal(before)
+		json.Unmarshal(data, &oldFields)
+	}
+	newFields := map[string]any{}
+	data, _ := json.Marshal(after)
+	json.Unmarshal(data, &newFields)
+
+	changes := models.RevisionChanges{}
+	for field, newValue := range newFields {
+		oldValue := oldFields[field]
+		if before != nil && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		changes[field] = models.FieldChange{Old: oldValue, New: newValue}
+	}
+	return changes
+}
+
+// recordProductRevision appends a revision for product. before is the state
+// prior to the change (nil on create). Updates that changed nothing are not
+// recorded.
+func recordProductRevision(tx *gorm.DB, action string, before, after *models.Product, actorID uint) error {
+	return recordProductRevisionFrom(tx, action, before, after, actorID, nil)
+}
+
+func recordProductRevisionFrom(tx *gorm.DB, action string, before, after *models.Product, actorID uint, revertedFrom *uint) error {
+	snapshot := snapshotProduct(after)
+
+	var changes models.RevisionChanges
+	switch action {
+	case models.RevisionActionDelete, models.RevisionActionRestore:
+		changes = models.RevisionChanges{}
+	case models.RevisionActionCreate:
+		changes = diffSnapshots(nil, snapshot)
+	default:
+		beforeSnapshot := snapshotProduct(before)
+		changes = diffSnapshots(&beforeSnapshot, snapshot)
+		if len(changes) == 0 {
+			return nil
+		}
+	}
+
+	revision := models.ProductRevision{
+		ProductID:    after.ID,
+		OwnerID:      after.OwnerID,
+		ActorID:      actorID,
+		Action:       action,
+		Changes:      changes,
+		Snapshot:     snapshot,
+		RevertedFrom: revertedFrom,
+	}
+	return tx.Create(&revision).Error
+}
+
+func GetProductHistory(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	// History stays readable while the product is in the trash.
+	var count int64
+	database.DB.Unscoped().Model(&models.Product{}).Where("id = ? AND owner_id = ?", uint(id), ownerID).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	var revisions []models.ProductRevision
+	if err := database.DB.Where("product_id = ? AND owner_id = ?", uint(id), ownerID).Order("id desc").Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve product history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// RevertProduct restores the fields of a product to the snapshot taken after
+// the given revision. Images are left as they are.
+func RevertProduct(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+	revisionID, err := strconv.ParseUint(c.Param("revisionId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision id"})
+		return
+	}
+
+	var product models.Product
+	if err := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve product"})
+		return
+	}
+
+	var revision models.ProductRevision
+	if err := database.DB.Where("id = ? AND product_id = ? AND owner_id = ?", uint(revisionID), product.ID, ownerID).First(&revision).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve revision"})
+		return
+	}
+
+	snapshot := revision.Snapshot
+	if snapshot.CollectionID != nil {
+		var count int64
+		database.DB.Model(&models.Collection{}).Where("id = ? AND owner_id = ?", *snapshot.CollectionID, ownerID).Count(&count)
+		if count == 0 {
+			snapshot.CollectionID = nil
+		}
+	}
+
+	if err := validatePricing(snapshot.Price, snapshot.CompareAtPrice, snapshot.SalePrice, snapshot.SaleStartsAt, snapshot.SaleEndsAt); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if snapshot.SKU != nil {
+		taken, err := skuInUse(database.DB, ownerID, *snapshot.SKU, product.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify SKU"})
+			return
+		}
+		if taken {
+			respondCatalogError(c, errSKUInUse)
+			return
+		}
+	}
+
+	if product.Status == models.ProductStatusArchived && snapshot.Status != models.ProductStatusArchived {
+		canCreate, plan, currentCount, err := CheckProductLimit(ownerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+			return
+		}
+		if !canCreate {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":            "Product limit reached",
+				"limit":            plan.MaxProducts,
+				"current_count":    currentCount,
+				"plan_name":        plan.DisplayName,
+				"upgrade_required": true,
+			})
+			return
+		}
+	}
+
+	var reverted models.Product
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Product{}).Where("id = ? AND owner_id = ?", product.ID, ownerID).Updates(snapshotColumns(snapshot)).Error; err != nil {
+			return err
+		}
+		if err := tx.Scopes(withProductRelations).First(&reverted, product.ID).Error; err != nil {
+			return err
+		}
+		return recordProductRevisionFrom(tx, models.RevisionActionRevert, &product, &reverted, ownerID, &revision.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revert product"})
+		return
+	}
+	if err := applyProductPricing(&reverted); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not compute prices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reverted)
+}
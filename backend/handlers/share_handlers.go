@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/FelippeTN/Web-Catalogo/backend/database"
 	"github.com/FelippeTN/Web-Catalogo/backend/models"
@@ -24,6 +25,8 @@ type publicCatalogResponse struct {
 	StoreLogo  string            `json:"store_logo"`
 }
 
+// ShareCollection returns a token that opens the collection, creating a
+// link for it when it has no usable one.
 func ShareCollection(c *gin.Context) {
 	ownerID, ok := getUserIDFromContext(c)
 	if !ok {
@@ -47,22 +50,333 @@ func ShareCollection(c *gin.Context) {
 		return
 	}
 
-	if collection.ShareToken == nil || *collection.ShareToken == "" {
-		token, err := utils.GenerateShareToken()
+	var link models.ShareLink
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("collection_id = ? AND is_active = ? AND (expires_at IS NULL OR expires_at > ?)", collection.ID, true, time.Now()).
+			Order("created_at").First(&link).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			link, err = createShareLink(tx, collection, "Link", nil)
+		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate share token"})
+			return err
+		}
+		return unlistPrivateCollection(tx, &collection)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save share token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, shareCollectionResponse{ShareToken: link.Token})
+}
+
+// UnshareCollection revokes every share link of a collection. An unlisted
+// collection, only reachable through them, becomes private.
+func UnshareCollection(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var collection models.Collection
+	if err := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&collection).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve collection"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("collection_id = ?", collection.ID).Delete(&models.ShareLink{}).Error; err != nil {
+			return err
+		}
+		if collection.Visibility != models.CollectionUnlisted {
+			return nil
+		}
+		return tx.Model(&collection).Update("visibility", models.CollectionPrivate).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke share token"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func GetShareLinks(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var collection models.Collection
+	if err := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&collection).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve collection"})
+		return
+	}
+
+	var links []models.ShareLink
+	if err := database.DB.Where("collection_id = ?", collection.ID).Order("created_at").Find(&links).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve share links"})
+		return
+	}
+
+	c.JSON(http.StatusOK, links)
+}
+
+func CreateShareLink(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var input models.CreateShareLinkInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	var collection models.Collection
+	if err := database.DB.Where("id = ? AND owner_id = ?", uint(id), ownerID).First(&collection).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve collection"})
+		return
+	}
+
+	var link models.ShareLink
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if link, err = createShareLink(tx, collection, input.Name, input.ExpiresAt); err != nil {
+			return err
+		}
+		return unlistPrivateCollection(tx, &collection)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create share link"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, link)
+}
+
+func UpdateShareLink(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+	linkID, err := strconv.ParseUint(c.Param("linkId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link id"})
+		return
+	}
+
+	var input models.UpdateShareLinkInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data"})
+		return
+	}
+
+	var link models.ShareLink
+	if err := database.DB.Where("id = ? AND collection_id = ? AND owner_id = ?", uint(linkID), uint(id), ownerID).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
 			return
 		}
-		collection.ShareToken = &token
-		if err := database.DB.Model(&models.Collection{}).
-			Where("id = ? AND owner_id = ?", uint(id), ownerID).
-			Update("share_token", token).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save share token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve share link"})
+		return
+	}
+
+	updates := map[string]any{}
+	if input.Name != nil {
+		if *input.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+			return
+		}
+		link.Name = *input.Name
+		updates["name"] = *input.Name
+	}
+	if input.IsActive != nil {
+		link.IsActive = *input.IsActive
+		updates["is_active"] = *input.IsActive
+	}
+	if input.ClearExpiry {
+		link.ExpiresAt = nil
+		updates["expires_at"] = nil
+	} else if input.ExpiresAt != nil {
+		if !input.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
 			return
 		}
+		link.ExpiresAt = input.ExpiresAt
+		updates["expires_at"] = input.ExpiresAt
 	}
 
-	c.JSON(http.StatusOK, shareCollectionResponse{ShareToken: *collection.ShareToken})
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	if err := database.DB.Model(&link).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update share link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, link)
+}
+
+// RotateShareLink gives a link a new token, so the old one stops working
+// while the link keeps its name and settings.
+func RotateShareLink(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+	linkID, err := strconv.ParseUint(c.Param("linkId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link id"})
+		return
+	}
+
+	var link models.ShareLink
+	if err := database.DB.Where("id = ? AND collection_id = ? AND owner_id = ?", uint(linkID), uint(id), ownerID).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve share link"})
+		return
+	}
+
+	token, err := utils.GenerateShareToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate share token"})
+		return
+	}
+	if err := database.DB.Model(&link).Update("token", token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not rotate share link"})
+		return
+	}
+	link.Token = token
+
+	c.JSON(http.StatusOK, link)
+}
+
+// DeleteShareLink revokes a single link; the other links of the collection
+// keep working.
+func DeleteShareLink(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+	linkID, err := strconv.ParseUint(c.Param("linkId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link id"})
+		return
+	}
+
+	result := database.DB.Where("id = ? AND collection_id = ? AND owner_id = ?", uint(linkID), uint(id), ownerID).Delete(&models.ShareLink{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete share link"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func createShareLink(tx *gorm.DB, collection models.Collection, name string, expiresAt *time.Time) (models.ShareLink, error) {
+	token, err := utils.GenerateShareToken()
+	if err != nil {
+		return models.ShareLink{}, err
+	}
+	link := models.ShareLink{
+		OwnerID:      collection.OwnerID,
+		CollectionID: collection.ID,
+		Name:         name,
+		Token:        token,
+		IsActive:     true,
+		ExpiresAt:    expiresAt,
+	}
+	return link, tx.Create(&link).Error
+}
+
+// unlistPrivateCollection makes a private collection unlisted, since it
+// can't be seen through its links otherwise.
+func unlistPrivateCollection(tx *gorm.DB, collection *models.Collection) error {
+	if collection.Visibility != models.CollectionPrivate {
+		return nil
+	}
+	collection.Visibility = models.CollectionUnlisted
+	return tx.Model(collection).Update("visibility", models.CollectionUnlisted).Error
+}
+
+// findSharedCollection returns the collection a share token opens, as long
+// as its link is enabled and unexpired and the collection isn't private.
+func findSharedCollection(token string) (models.Collection, error) {
+	links := database.DB.Model(&models.ShareLink{}).Select("collection_id").
+		Where("token = ? AND is_active = ? AND (expires_at IS NULL OR expires_at > ?)", token, true, time.Now())
+
+	var collection models.Collection
+	err := database.DB.Where("id IN (?) AND visibility <> ?", links, models.CollectionPrivate).First(&collection).Error
+	return collection, err
 }
 
 func GetPublicCatalogByToken(c *gin.Context) {
@@ -72,8 +386,8 @@ func GetPublicCatalogByToken(c *gin.Context) {
 		return
 	}
 
-	var collection models.Collection
-	if err := database.DB.Where("share_token = ?", token).First(&collection).Error; err != nil {
+	collection, err := findSharedCollection(token)
+	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Catalog not found"})
 			return
@@ -93,7 +407,15 @@ func GetPublicCatalogByToken(c *gin.Context) {
 	}
 
 	var products []models.Product
-	if err := database.DB.Preload("Images").Where("owner_id = ? AND collection_id = ?", collection.OwnerID, collection.ID).Order("created_at desc").Find(&products).Error; err != nil {
+	if err := database.DB.Scopes(withProductRelations).Scopes(publiclyVisible(time.Now())).Where("owner_id = ? AND collection_id = ?", collection.OwnerID, collection.ID).Order("created_at desc").Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve products"})
+		return
+	}
+	if err := applyPricing(products); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not compute prices"})
+		return
+	}
+	if err := preparePublicProducts(products); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve products"})
 		return
 	}
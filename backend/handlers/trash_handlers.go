@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TrashRetention is how long deleted products and collections stay in the
+// trash before PurgeTrash removes them for good.
+const TrashRetention = 30 * 24 * time.Hour
+
+type trashResponse struct {
+	Collections   []models.Collection `json:"collections"`
+	Products      []models.Product    `json:"products"`
+	RetentionDays int                 `json:"retention_days"`
+}
+
+func GetTrash(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var collections []models.Collection
+	if err := database.DB.Unscoped().Where("owner_id = ? AND deleted_at IS NOT NULL", ownerID).Order("deleted_at desc").Find(&collections).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve trash"})
+		return
+	}
+
+	var products []models.Product
+	if err := database.DB.Unscoped().Scopes(withProductRelations).Where("owner_id = ? AND deleted_at IS NOT NULL", ownerID).Order("deleted_at desc").Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve trash"})
+		return
+	}
+
+	c.JSON(http.StatusOK, trashResponse{
+		Collections:   collections,
+		Products:      products,
+		RetentionDays: int(TrashRetention / (24 * time.Hour)),
+	})
+}
+
+func RestoreProduct(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var product models.Product
+	if err := database.DB.Unscoped().Where("id = ? AND owner_id = ? AND deleted_at IS NOT NULL", uint(id), ownerID).First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found in trash"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve product"})
+		return
+	}
+
+	if product.Status != models.ProductStatusArchived {
+		canCreate, plan, currentCount, err := CheckProductLimit(ownerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+			return
+		}
+		if !canCreate {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":            "Product limit reached",
+				"limit":            plan.MaxProducts,
+				"current_count":    currentCount,
+				"plan_name":        plan.DisplayName,
+				"upgrade_required": true,
+			})
+			return
+		}
+	}
+
+	updates := map[string]any{"deleted_at": nil}
+
+	// The SKU may have been reused while the product was in the trash.
+	if product.SKU != nil {
+		if taken, err := skuInUse(database.DB, ownerID, *product.SKU, product.ID); err == nil && taken {
+			updates["sku"] = nil
+		}
+	}
+
+	// A product whose collection is still in the trash comes back without a
+	// collection rather than staying invisible.
+	if product.CollectionID != nil {
+		var count int64
+		database.DB.Model(&models.Collection{}).Where("id = ? AND owner_id = ?", *product.CollectionID, ownerID).Count(&count)
+		if count == 0 {
+			updates["collection_id"] = nil
+		}
+	}
+
+	var restored models.Product
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Product{}).Where("id = ? AND owner_id = ?", product.ID, ownerID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Scopes(withProductRelations).First(&restored, product.ID).Error; err != nil {
+			return err
+		}
+		return recordProductRevision(tx, models.RevisionActionRestore, &product, &restored, ownerID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not restore product"})
+		return
+	}
+	if err := applyProductPricing(&restored); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not compute prices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, restored)
+}
+
+// RestoreCollection brings back a collection together with the products that
+// were trashed along with it.
+func RestoreCollection(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var collection models.Collection
+	if err := database.DB.Unscoped().Where("id = ? AND owner_id = ? AND deleted_at IS NOT NULL", uint(id), ownerID).First(&collection).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found in trash"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve collection"})
+		return
+	}
+
+	batch := database.DB.Unscoped().Model(&models.Product{}).
+		Where("owner_id = ? AND collection_id = ? AND deleted_at = ?", ownerID, collection.ID, collection.DeletedAt.Time)
+
+	var newProducts int64
+	if err := batch.Session(&gorm.Session{}).Where("status <> ?", models.ProductStatusArchived).Count(&newProducts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve products"})
+		return
+	}
+
+	canCreate, plan, currentCount, err := CheckCollectionLimit(ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+		return
+	}
+	if !canCreate {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":            "Collection limit reached",
+			"limit":            plan.MaxCollections,
+			"current_count":    currentCount,
+			"plan_name":        plan.DisplayName,
+			"upgrade_required": true,
+		})
+		return
+	}
+
+	_, plan, productCount, err := CheckProductLimit(ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify plan limits"})
+		return
+	}
+	if plan.MaxProducts != -1 && productCount+int(newProducts) > plan.MaxProducts {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":            "Product limit reached",
+			"limit":            plan.MaxProducts,
+			"current_count":    productCount,
+			"plan_name":        plan.DisplayName,
+			"upgrade_required": true,
+		})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var products []models.Product
+		if err := tx.Unscoped().
+			Where("owner_id = ? AND collection_id = ? AND deleted_at = ?", ownerID, collection.ID, collection.DeletedAt.Time).
+			Find(&products).Error; err != nil {
+			return err
+		}
+		for i := range products {
+			updates := map[string]any{"deleted_at": nil}
+			if products[i].SKU != nil {
+				taken, err := skuInUse(tx, ownerID, *products[i].SKU, products[i].ID)
+				if err != nil {
+					return err
+				}
+				if taken {
+					updates["sku"] = nil
+				}
+			}
+			if err := tx.Unscoped().Model(&products[i]).Updates(updates).Error; err != nil {
+				return err
+			}
+			if err := recordProductRevision(tx, models.RevisionActionRestore, &products[i], &products[i], ownerID); err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Model(&models.Collection{}).Where("id = ? AND owner_id = ?", collection.ID, ownerID).Update("deleted_at", nil).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not restore collection"})
+		return
+	}
+
+	collection.DeletedAt = gorm.DeletedAt{}
+	c.JSON(http.StatusOK, collection)
+}
+
+// PurgeTrash permanently deletes products and collections that have been in
+// the trash for longer than TrashRetention. Order items keep their snapshot
+// data; their product_id is set to NULL by the foreign key.
+func PurgeTrash() error {
+	cutoff := time.Now().Add(-TrashRetention)
+
+	var purgedImages []models.ProductImage
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var productIDs []uint
+		if err := tx.Unscoped().Model(&models.Product{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Pluck("id", &productIDs).Error; err != nil {
+			return err
+		}
+		if len(productIDs) > 0 {
+			if err := tx.Where("product_id IN ?", productIDs).Find(&purgedImages).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("product_id IN ?", productIDs).Delete(&models.ProductImage{}).Error; err != nil {
+				return err
+			}
+			if err := releaseImageFiles(tx, purgedImages); err != nil {
+				return err
+			}
+			if err := tx.Where("product_id IN ?", productIDs).Delete(&models.ProductAttributeValue{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("product_id IN ?", productIDs).Delete(&models.ProductRevision{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("id IN ?", productIDs).Delete(&models.Product{}).Error; err != nil {
+				return err
+			}
+		}
+
+		var collectionIDs []uint
+		if err := tx.Unscoped().Model(&models.Collection{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Pluck("id", &collectionIDs).Error; err != nil {
+			return err
+		}
+		if len(collectionIDs) > 0 {
+			// Products restored on their own, or still in the trash, must not
+			// point at a collection that no longer exists.
+			if err := tx.Unscoped().Model(&models.Product{}).Where("collection_id IN ?", collectionIDs).Update("collection_id", nil).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("collection_id IN ?", collectionIDs).Delete(&models.Campaign{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("collection_id IN ?", collectionIDs).Delete(&models.ShareLink{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("id IN ?", collectionIDs).Delete(&models.Collection{}).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(productIDs) > 0 || len(collectionIDs) > 0 {
+			log.Printf("Trash purge: removed %d products and %d collections", len(productIDs), len(collectionIDs))
+		}
+		return nil
+	})
+	return err
+}
+
+// StartTrashPurge runs PurgeTrash now and then at every interval.
+func StartTrashPurge(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := PurgeTrash(); err != nil {
+				log.Printf("Trash purge failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
+	"github.com/FelippeTN/Web-Catalogo/backend/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var uploadContentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".webp": "image/webp",
+}
+
+// ServeUpload serves "/uploads/*filepath" from the configured storage,
+// redirecting to the backend's public URL when it has one.
+func ServeUpload(c *gin.Context) {
+	key, ok := storage.KeyFromURL(storage.URLPrefix + c.Param("filepath")[1:])
+	if !ok || utils.IsPendingKey(key) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if url := storage.Store.URL(key); url != "" {
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+
+	file, err := storage.Store.Get(key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	// A key always holds the same content, so files can be cached for good.
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	// Only images are served inline, and browsers must not second-guess the
+	// type or run anything they find in the file.
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+	if contentType, ok := uploadContentTypes[path.Ext(key)]; ok {
+		c.Header("Content-Type", contentType)
+	} else {
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Disposition", "attachment")
+	}
+
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, "", time.Time{}, seeker)
+		return
+	}
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, file)
+}
+
+// UploadGCGracePeriod keeps recent files out of the collector: uploads are
+// stored before the rows that reference them are committed.
+const UploadGCGracePeriod = 24 * time.Hour
+
+// referencedUploadsQuery lists every upload URL the database points at.
+// Trashed products keep their files until PurgeTrash, and order items keep
+// the image they were bought with.
+const referencedUploadsQuery = `
+	SELECT url FROM (
+		SELECT image_url AS url FROM product_images
+		UNION SELECT jsonb_array_elements(variants)->>'url' FROM product_images WHERE jsonb_typeof(variants) = 'array'
+		UNION SELECT jsonb_array_elements(watermarked)->>'url' FROM product_images WHERE jsonb_typeof(watermarked) = 'array'
+		UNION SELECT image_url FROM products
+		UNION SELECT logo_url FROM users
+		UNION SELECT image_url FROM order_items
+	) refs WHERE url IS NOT NULL AND url <> ''`
+
+// CollectOrphanedUploads deletes stored files that no record references and
+// that are older than UploadGCGracePeriod.
+func CollectOrphanedUploads() error {
+	var urls []string
+	if err := database.DB.Raw(referencedUploadsQuery).Scan(&urls).Error; err != nil {
+		return err
+	}
+	referenced := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		if key, ok := storage.KeyFromURL(url); ok {
+			referenced[key] = true
+		}
+	}
+
+	cutoff := time.Now().Add(-UploadGCGracePeriod)
+	var orphans []string
+	err := storage.Store.Walk(func(file storage.File) error {
+		if !referenced[file.Key] && file.ModTime.Before(cutoff) {
+			orphans = append(orphans, file.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	removed := 0
+	for _, key := range orphans {
+		// The walk can take a while; a file may have been reused since the
+		// references were listed.
+		if !utils.IsPendingKey(key) && uploadInUse(storage.URLFromKey(key)) {
+			continue
+		}
+		if err := storage.Store.Delete(key); err != nil {
+			log.Printf("Upload GC: could not delete %s: %v", key, err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("Upload GC: removed %d orphaned files", removed)
+	}
+	return nil
+}
+
+// StartUploadGC runs CollectOrphanedUploads now and then at every interval.
+func StartUploadGC(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := CollectOrphanedUploads(); err != nil {
+				log.Printf("Upload GC failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// removeUploadsIfUnused deletes the given files right away unless another
+// record still points at them (an order snapshot...). It is meant for files
+// stored under a unique key, like logos; content-addressed image files are
+// left to CollectOrphanedUploads. Anything missed here is left to it too.
+func removeUploadsIfUnused(urls []string) {
+	for _, url := range urls {
+		if url == "" || uploadInUse(url) {
+			continue
+		}
+		if err := utils.RemoveUpload(url); err != nil {
+			log.Printf("Could not delete upload %s: %v", url, err)
+		}
+	}
+}
+
+// uploadInUse reports whether a record points at url. Errors count as in
+// use, so nothing is deleted on a failed lookup.
+func uploadInUse(url string) bool {
+	var count int64
+	err := database.DB.Raw(`SELECT COUNT(*) FROM (`+referencedUploadsQuery+`) used WHERE used.url = ?`, url).Scan(&count).Error
+	return err != nil || count > 0
+}
+
+// releaseImageFiles drops the references of deleted images to their files.
+// Files no image uses anymore are not deleted here: the same photo may be
+// uploaded again while this runs, and reuse the file before its reference
+// is committed. They are removed by CollectOrphanedUploads instead.
+func releaseImageFiles(tx *gorm.DB, images []models.ProductImage) error {
+	refs := map[string]int{}
+	for _, image := range images {
+		refs[image.ImageURL]++
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	urls := make([]string, 0, len(refs))
+	for url, count := range refs {
+		err := tx.Model(&models.ImageFile{}).Where("url = ?", url).
+			UpdateColumn("ref_count", gorm.Expr("ref_count - ?", count)).Error
+		if err != nil {
+			return err
+		}
+		urls = append(urls, url)
+	}
+	return tx.Where("url IN ? AND ref_count <= 0", urls).Delete(&models.ImageFile{}).Error
+}
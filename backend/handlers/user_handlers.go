@@ -73,6 +73,10 @@ func UpdateMe(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao atualizar dados. Verifique se o email ou nome já estão em uso."})
 		return
 	}
+	// The store name is the watermark of stores without a logo.
+	if input.Username != "" {
+		syncWatermarksAsync(user.ID)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Dados atualizados com sucesso", "user": user})
 }
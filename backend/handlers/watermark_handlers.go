@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/database"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// watermarkMu keeps two syncs from drawing the same images at once.
+var watermarkMu sync.Mutex
+
+func UpdateWatermark(c *gin.Context) {
+	ownerID, ok := getUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Não autorizado"})
+		return
+	}
+
+	var input models.UpdateWatermarkInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, ownerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+
+	if input.Enabled != nil {
+		user.WatermarkEnabled = *input.Enabled
+	}
+	if input.Position != nil {
+		if !utils.IsValidWatermarkPosition(*input.Position) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Posição da marca d'água inválida"})
+			return
+		}
+		user.WatermarkPosition = *input.Position
+	}
+	if input.Opacity != nil {
+		if *input.Opacity < 1 || *input.Opacity > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A opacidade deve estar entre 1 e 100"})
+			return
+		}
+		user.WatermarkOpacity = *input.Opacity
+	}
+
+	err := database.DB.Model(&user).Updates(map[string]any{
+		"watermark_enabled":  user.WatermarkEnabled,
+		"watermark_position": user.WatermarkPosition,
+		"watermark_opacity":  user.WatermarkOpacity,
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar marca d'água"})
+		return
+	}
+	syncWatermarksAsync(ownerID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Marca d'água atualizada com sucesso", "user": user})
+}
+
+// SyncWatermarks brings the watermarked copies of an owner's images in line
+// with the settings: drawn with the current watermark when it's enabled,
+// dropped otherwise. Images already up to date are skipped.
+func SyncWatermarks(ownerID uint) error {
+	watermarkMu.Lock()
+	defer watermarkMu.Unlock()
+
+	var user models.User
+	if err := database.DB.First(&user, ownerID).Error; err != nil {
+		return err
+	}
+
+	var mark utils.Watermark
+	signature := ""
+	if user.WatermarkEnabled {
+		mark = utils.LoadWatermark(user.LogoURL, user.Username, user.WatermarkPosition, user.WatermarkOpacity)
+		signature = mark.Signature()
+	}
+	if err := database.DB.Model(&user).Update("watermark_signature", signature).Error; err != nil {
+		return err
+	}
+
+	var images []models.ProductImage
+	ownerProducts := database.DB.Unscoped().Model(&models.Product{}).Select("id").Where("owner_id = ?", ownerID)
+	if err := database.DB.Where("product_id IN (?) AND status = ? AND watermark_signature <> ?", ownerProducts, models.ProductImageReady, signature).Find(&images).Error; err != nil {
+		return err
+	}
+
+	// Copies no longer used are left to the upload collector, since images
+	// sharing a file share their watermarked copies too.
+	for _, image := range images {
+		var marked []models.ImageVariant
+		if signature != "" {
+			var err error
+			marked, err = utils.GenerateWatermarkedVariants(image.ImageURL, image.Variants, mark)
+			if err != nil {
+				log.Printf("Could not watermark image %d (%s): %v", image.ID, image.ImageURL, err)
+				continue
+			}
+		}
+		err := database.DB.Model(&image).Updates(map[string]any{
+			"watermarked":         models.ImageVariants(marked),
+			"watermark_signature": signature,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncWatermarksAsync runs SyncWatermarks in the background so requests
+// don't wait for images to be drawn. Until then, visitors don't see the
+// images missing the new watermark; see preparePublicProducts.
+func syncWatermarksAsync(ownerID uint) {
+	go func() {
+		if err := SyncWatermarks(ownerID); err != nil {
+			log.Printf("Watermark sync for user %d failed: %v", ownerID, err)
+		}
+	}()
+}
+
+// preparePublicProducts prepares products to be shown to visitors. Stores
+// with a watermark only show the images already drawn with it.
+func preparePublicProducts(products []models.Product) error {
+	ownerSet := map[uint]struct{}{}
+	var ownerIDs []uint
+	for _, product := range products {
+		if _, seen := ownerSet[product.OwnerID]; !seen {
+			ownerSet[product.OwnerID] = struct{}{}
+			ownerIDs = append(ownerIDs, product.OwnerID)
+		}
+	}
+
+	var owners []models.User
+	if len(ownerIDs) > 0 {
+		if err := database.DB.Select("id", "watermark_enabled", "watermark_signature").Where("id IN ?", ownerIDs).Find(&owners).Error; err != nil {
+			return err
+		}
+	}
+	signatures := map[uint]string{}
+	for _, owner := range owners {
+		if owner.WatermarkEnabled {
+			signatures[owner.ID] = owner.WatermarkSignature
+		}
+	}
+
+	for i := range products {
+		products[i].HideUnreadyImages()
+		if signature, ok := signatures[products[i].OwnerID]; ok {
+			products[i].HideUnwatermarkedImages(signature)
+		}
+		products[i].UseWatermarkedImages()
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+const (
+	AttributeTypeText    = "text"
+	AttributeTypeNumber  = "number"
+	AttributeTypeSelect  = "select"
+	AttributeTypeBoolean = "boolean"
+)
+
+// IsValidAttributeType reports whether t is one of the supported attribute types.
+func IsValidAttributeType(t string) bool {
+	switch t {
+	case AttributeTypeText, AttributeTypeNumber, AttributeTypeSelect, AttributeTypeBoolean:
+		return true
+	}
+	return false
+}
+
+// AttributeDefinition is a custom product field defined by a store, such as
+// "material" or "voltage". Options holds the comma-separated choices of a
+// select attribute.
+type AttributeDefinition struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OwnerID   uint      `gorm:"not null;uniqueIndex:idx_attribute_owner_key" json:"owner_id"`
+	Key       string    `gorm:"not null;uniqueIndex:idx_attribute_owner_key" json:"key"`
+	Label     string    `gorm:"not null" json:"label"`
+	Type      string    `gorm:"not null" json:"type"`
+	Options   string    `json:"options"`
+	Required  bool      `gorm:"not null;default:false" json:"required"`
+	Position  int       `gorm:"not null;default:0" json:"position"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// ProductAttributeValue is the value of a custom attribute on a product, kept
+// as text in a canonical form for its type ("true"/"false" for booleans).
+type ProductAttributeValue struct {
+	ID          uint                 `gorm:"primaryKey" json:"-"`
+	ProductID   uint                 `gorm:"not null;uniqueIndex:idx_product_attribute" json:"-"`
+	AttributeID uint                 `gorm:"not null;uniqueIndex:idx_product_attribute;index" json:"attribute_id"`
+	Attribute   *AttributeDefinition `gorm:"foreignKey:AttributeID" json:"attribute,omitempty"`
+	Value       string               `gorm:"not null" json:"value"`
+}
+
+type CreateAttributeInput struct {
+	Key      string `json:"key" binding:"required"`
+	Label    string `json:"label" binding:"required"`
+	Type     string `json:"type" binding:"required"`
+	Options  string `json:"options"`
+	Required bool   `json:"required"`
+	Position int    `json:"position"`
+}
+
+type UpdateAttributeInput struct {
+	Label    *string `json:"label"`
+	Options  *string `json:"options"`
+	Required *bool   `json:"required"`
+	Position *int    `json:"position"`
+}
@@ -0,0 +1,48 @@
+package models
+
+const (
+	BulkActionAdjustPrice    = "adjust_price"
+	BulkActionMoveCollection = "move_collection"
+	BulkActionSetStatus      = "set_status"
+	BulkActionAddTags        = "add_tags"
+	BulkActionRemoveTags     = "remove_tags"
+	BulkActionDelete         = "delete"
+)
+
+// BulkProductFilter selects products by their attributes instead of by ID.
+type BulkProductFilter struct {
+	CollectionID *uint   `json:"collection_id"`
+	Status       *string `json:"status"`
+	Tag          *string `json:"tag"`
+	Search       *string `json:"search"`
+}
+
+// BulkProductInput describes a bulk operation: the selection (ProductIDs or
+// Filter), the action and its parameters. With DryRun the resulting changes
+// are returned without being saved.
+type BulkProductInput struct {
+	ProductIDs []uint             `json:"product_ids"`
+	Filter     *BulkProductFilter `json:"filter"`
+	Action     string             `json:"action" binding:"required"`
+	DryRun     bool               `json:"dry_run"`
+
+	// adjust_price: exactly one of PricePercent (e.g. 10 or -15) or
+	// PriceAmount (added to the price, may be negative).
+	PricePercent *float64 `json:"price_percent"`
+	PriceAmount  *float64 `json:"price_amount"`
+
+	// move_collection: 0 removes the products from their collection.
+	CollectionID *uint `json:"collection_id"`
+
+	Status *string  `json:"status"`
+	Tags   []string `json:"tags"`
+}
+
+// BulkProductChange is the before/after value of each field changed on one
+// product; both are empty for deletions.
+type BulkProductChange struct {
+	ProductID uint           `json:"product_id"`
+	Name      string         `json:"name"`
+	Before    map[string]any `json:"before"`
+	After     map[string]any `json:"after"`
+}
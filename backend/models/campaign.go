@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Campaign is a percentage discount applied to every product of a collection,
+// or to the whole store when CollectionID is nil, during an optional window.
+type Campaign struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	OwnerID         uint       `gorm:"not null;index" json:"owner_id"`
+	CollectionID    *uint      `gorm:"index" json:"collection_id"`
+	Name            string     `gorm:"not null" json:"name"`
+	DiscountPercent float64    `gorm:"not null" json:"discount_percent"`
+	StartsAt        *time.Time `json:"starts_at"`
+	EndsAt          *time.Time `json:"ends_at"`
+	IsActive        bool       `gorm:"not null;default:true" json:"is_active"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type CreateCampaignInput struct {
+	Name            string     `json:"name" binding:"required"`
+	CollectionID    *uint      `json:"collection_id"`
+	DiscountPercent float64    `json:"discount_percent" binding:"required"`
+	StartsAt        *time.Time `json:"starts_at"`
+	EndsAt          *time.Time `json:"ends_at"`
+}
+
+// UpdateCampaignInput changes a campaign. The Clear flags remove the window
+// ends or the collection, making the campaign store-wide, since a null can't
+// be told apart from a missing field.
+type UpdateCampaignInput struct {
+	Name            *string    `json:"name"`
+	CollectionID    *uint      `json:"collection_id"`
+	DiscountPercent *float64   `json:"discount_percent"`
+	StartsAt        *time.Time `json:"starts_at"`
+	EndsAt          *time.Time `json:"ends_at"`
+	IsActive        *bool      `json:"is_active"`
+
+	ClearCollection bool `json:"clear_collection"`
+	ClearStartsAt   bool `json:"clear_starts_at"`
+	ClearEndsAt     bool `json:"clear_ends_at"`
+}
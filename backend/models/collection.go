@@ -1,23 +1,62 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// CollectionPrivate collections are only seen by their owner.
+	CollectionPrivate = "private"
+	// CollectionUnlisted collections are seen through their share link.
+	CollectionUnlisted = "unlisted"
+	// CollectionPublic collections are also listed on the storefront.
+	CollectionPublic = "public"
+)
+
+// IsValidCollectionVisibility reports whether visibility is one of the known modes.
+func IsValidCollectionVisibility(visibility string) bool {
+	switch visibility {
+	case CollectionPrivate, CollectionUnlisted, CollectionPublic:
+		return true
+	}
+	return false
+}
 
 type Collection struct {
-	ID          uint      `gorm:"primaryKey" json:"id"`
-	OwnerID     uint      `gorm:"not null;index" json:"owner_id"`
-	ShareToken  *string   `gorm:"uniqueIndex" json:"share_token"`
-	Name        string    `gorm:"not null" json:"name"`
-	Description string    `gorm:"not null;default:''" json:"description"`
-	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	OwnerID     uint   `gorm:"not null;index" json:"owner_id"`
+	Visibility  string `gorm:"not null;default:'public'" json:"visibility"`
+	Name        string `gorm:"not null" json:"name"`
+	Description string `gorm:"not null;default:''" json:"description"`
+
+	// Description is Markdown; DescriptionHTML is its sanitised rendering.
+	DescriptionHTML string `gorm:"-" json:"description_html"`
+
+	CreatedAt time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+func (c *Collection) AfterFind(tx *gorm.DB) error {
+	c.DescriptionHTML = renderMarkdown(c.Description)
+	return nil
+}
+
+func (c *Collection) AfterSave(tx *gorm.DB) error {
+	c.DescriptionHTML = renderMarkdown(c.Description)
+	return nil
 }
 
 type CreateCollectionInput struct {
 	Name        string `json:"name" binding:"required"`
 	Description string `json:"description"`
+	Visibility  string `json:"visibility"`
 }
 
 type UpdateCollectionInput struct {
 	Name        *string `json:"name"`
 	Description *string `json:"description"`
+	Visibility  *string `json:"visibility"`
 }
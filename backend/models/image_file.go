@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ImageFile counts the product images that point at a stored image file.
+// Uploads are stored under the hash of their content, so a photo used by
+// several products, or by a duplicated one, is stored once; the file and its
+// variants can be removed when the count drops to zero.
+type ImageFile struct {
+	URL       string    `gorm:"primaryKey" json:"url"`
+	RefCount  int       `gorm:"not null;default:0" json:"ref_count"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// AddImageFileRef counts one more image pointing at url.
+func AddImageFileRef(tx *gorm.DB, url string) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "url"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"ref_count":  gorm.Expr("image_files.ref_count + 1"),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&ImageFile{URL: url, RefCount: 1}).Error
+}
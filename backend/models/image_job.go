@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	ImageJobPending = "pending"
+	ImageJobRunning = "running"
+	ImageJobFailed  = "failed"
+)
+
+// ImageJob queues the processing of an uploaded product image: compressing
+// it and generating its variants. Failed attempts are retried from RunAfter
+// on, up to config.ImageJobMaxAttempts; jobs are deleted once they succeed
+// and kept when they fail for good.
+type ImageJob struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	ImageID    uint       `gorm:"not null;index" json:"image_id"`
+	Status     string     `gorm:"not null;default:'pending';index" json:"status"`
+	Attempts   int        `gorm:"not null;default:0" json:"attempts"`
+	LastError  string     `json:"last_error"`
+	RunAfter   time.Time  `gorm:"not null" json:"run_after"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+const (
+	ImportJobPending   = "pending"
+	ImportJobRunning   = "running"
+	ImportJobCompleted = "completed"
+	ImportJobFailed    = "failed"
+)
+
+// ImportRowError reports why a row of an import file was skipped. Row is the
+// 1-based line number in the spreadsheet, header included.
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// ImportRowErrors is stored as a JSON column.
+type ImportRowErrors []ImportRowError
+
+func (e ImportRowErrors) Value() (driver.Value, error) {
+	if e == nil {
+		return "[]", nil
+	}
+	return jsonValue(e)
+}
+
+func (e *ImportRowErrors) Scan(value any) error {
+	*e = nil
+	return jsonScan(value, e)
+}
+
+// ImportJob tracks a background bulk product import.
+type ImportJob struct {
+	ID            uint            `gorm:"primaryKey" json:"id"`
+	OwnerID       uint            `gorm:"not null;index" json:"owner_id"`
+	Status        string          `gorm:"not null;default:'pending'" json:"status"`
+	FileName      string          `json:"file_name"`
+	TotalRows     int             `gorm:"not null;default:0" json:"total_rows"`
+	ProcessedRows int             `gorm:"not null;default:0" json:"processed_rows"`
+	CreatedCount  int             `gorm:"not null;default:0" json:"created_count"`
+	FailedCount   int             `gorm:"not null;default:0" json:"failed_count"`
+	Errors        ImportRowErrors `gorm:"type:jsonb" json:"errors"`
+	Message       string          `json:"message"`
+	CreatedAt     time.Time       `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
+	FinishedAt    *time.Time      `json:"finished_at"`
+}
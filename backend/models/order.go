@@ -13,14 +13,21 @@ type Order struct {
 	CreatedAt    time.Time   `gorm:"autoCreateTime" json:"created_at"`
 }
 
+// OrderItem keeps a snapshot of what was bought, so orders still read
+// correctly after the product is edited or deleted.
 type OrderItem struct {
 	ID        uint    `gorm:"primaryKey" json:"id"`
 	OrderID   uint    `gorm:"not null;index" json:"order_id"`
 	ProductID *uint    `gorm:"index;constraint:OnDelete:SET NULL" json:"product_id"`
-	Product   *Product `json:"product"`
+	Product   *Product `json:"product,omitempty"`
+	OwnerID   *uint    `gorm:"index" json:"owner_id"` // Store that sold the product
 	Quantity  int     `gorm:"not null" json:"quantity"`
-	Size      string  `json:"size"`
+	Size      string  `json:"size"`                  // Snapshot size label
 	Price     float64 `gorm:"not null" json:"price"` // Snapshot price
+
+	ProductName string `gorm:"not null;default:''" json:"product_name"`
+	ProductSKU  string `gorm:"not null;default:''" json:"product_sku"`
+	ImageURL    string `gorm:"not null;default:''" json:"image_url"`
 }
 
 type CreateOrderInput struct {
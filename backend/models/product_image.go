@@ -1,11 +1,141 @@
 package models
 
-import "time"
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ImageFormatJPEG = "jpeg"
+	ImageFormatWebP = "webp"
+)
+
+const (
+	ProductImageProcessing = "processing"
+	ProductImageReady      = "ready"
+	ProductImageFailed     = "failed"
+)
 
 type ProductImage struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	ProductID uint      `gorm:"not null;index" json:"product_id"`
-	ImageURL  string    `gorm:"not null" json:"image_url"`
-	Position  int       `gorm:"not null;default:0" json:"position"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	ID        uint          `gorm:"primaryKey" json:"id"`
+	ProductID uint          `gorm:"not null;index" json:"product_id"`
+	ImageURL  string        `gorm:"not null" json:"image_url"`
+	AltText   string        `gorm:"not null;default:''" json:"alt_text"`
+	Position  int           `gorm:"not null;default:0" json:"position"`
+	Variants  ImageVariants `gorm:"type:jsonb" json:"variants"`
+	SizeBytes int64         `gorm:"not null;default:0" json:"size_bytes"` // original plus variants
+
+	// Status is "processing" until the upload is compressed and its variants
+	// are generated by an ImageJob, and "failed" when that gave up.
+	Status          string `gorm:"not null;default:'ready'" json:"status"`
+	ProcessingError string `gorm:"not null;default:''" json:"processing_error,omitempty"`
+
+	// Watermarked are the variants with the store's watermark, shown to
+	// visitors instead of Variants; WatermarkSignature identifies the
+	// watermark they were drawn with.
+	Watermarked        ImageVariants `gorm:"type:jsonb" json:"-"`
+	WatermarkSignature string        `gorm:"not null;default:''" json:"-"`
+	CreatedAt          time.Time     `gorm:"autoCreateTime" json:"created_at"`
+
+	// Srcset lists the variants of each format as an HTML srcset value,
+	// e.g. "/uploads/x_thumb.webp 200w, /uploads/x_card.webp 600w".
+	Srcset ImageSrcset `gorm:"-" json:"srcset"`
+}
+
+type ImageSrcset struct {
+	JPEG string `json:"jpeg"`
+	WebP string `json:"webp"`
+}
+
+// ImageVariant is a resized copy of an uploaded image.
+type ImageVariant struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+	Size   int64  `json:"size"`
+}
+
+// ImageVariants are the resized copies generated for an image.
+type ImageVariants []ImageVariant
+
+func (v ImageVariants) Value() (driver.Value, error) {
+	return jsonValue(v)
+}
+
+func (v *ImageVariants) Scan(value any) error {
+	return jsonScan(value, v)
+}
+
+func (v ImageVariants) srcset(format string) string {
+	var parts []string
+	for _, variant := range v {
+		if variant.Format == format {
+			parts = append(parts, fmt.Sprintf("%s %dw", variant.URL, variant.Width))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (img *ProductImage) AfterFind(tx *gorm.DB) error {
+	img.fillSrcset()
+	return nil
+}
+
+func (img *ProductImage) AfterSave(tx *gorm.DB) error {
+	img.fillSrcset()
+	return nil
+}
+
+func (img *ProductImage) fillSrcset() {
+	img.Srcset = ImageSrcset{
+		JPEG: img.Variants.srcset(ImageFormatJPEG),
+		WebP: img.Variants.srcset(ImageFormatWebP),
+	}
+}
+
+// UseWatermarked swaps the variants for their watermarked copies, if any,
+// before the image is shown to visitors.
+func (img *ProductImage) UseWatermarked() {
+	if len(img.Watermarked) == 0 {
+		return
+	}
+	img.Variants = img.Watermarked
+	// Variants go from the smallest to the largest.
+	for _, variant := range img.Watermarked {
+		if variant.Format == ImageFormatJPEG {
+			img.ImageURL = variant.URL
+		}
+	}
+	img.fillSrcset()
+}
+
+type ReorderProductImagesInput struct {
+	ImageIDs []uint `json:"image_ids" binding:"required"`
+}
+
+type UpdateProductImageInput struct {
+	AltText *string `json:"alt_text"`
+}
+
+// EditProductImageInput describes a crop, a rotation and a square padding,
+// applied in that order.
+type EditProductImageInput struct {
+	Crop       *ImageCrop `json:"crop"`
+	Rotate     int        `json:"rotate"`
+	PadSquare  bool       `json:"pad_square"`
+	Background string     `json:"background"`
+}
+
+// ImageCrop is a rectangle in pixels of the stored image.
+type ImageCrop struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
 }
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+const (
+	RevisionActionCreate  = "create"
+	RevisionActionUpdate  = "update"
+	RevisionActionDelete  = "delete"
+	RevisionActionRestore = "restore"
+	RevisionActionRevert  = "revert"
+)
+
+// ProductSnapshot holds the editable fields of a product as they were after a
+// revision. Images and custom attributes are not part of it.
+type ProductSnapshot struct {
+	Name           string     `json:"name"`
+	Description    string     `json:"description"`
+	Price          float64    `json:"price"`
+	CompareAtPrice *float64   `json:"compare_at_price"`
+	SalePrice      *float64   `json:"sale_price"`
+	SaleStartsAt   *time.Time `json:"sale_starts_at"`
+	SaleEndsAt     *time.Time `json:"sale_ends_at"`
+	Sizes          string     `json:"sizes"`
+	Tags           string     `json:"tags"`
+	Stock          *int       `json:"stock"`
+	SKU            *string    `json:"sku"`
+	Barcode        *string    `json:"barcode"`
+	WeightGrams    *int       `json:"weight_grams"`
+	LengthCm       *float64   `json:"length_cm"`
+	WidthCm        *float64   `json:"width_cm"`
+	HeightCm       *float64   `json:"height_cm"`
+	Status         string     `json:"status"`
+	PublishAt      *time.Time `json:"publish_at"`
+	UnpublishAt    *time.Time `json:"unpublish_at"`
+	CollectionID   *uint      `json:"collection_id"`
+}
+
+func (s ProductSnapshot) Value() (driver.Value, error) {
+	return jsonValue(s)
+}
+
+func (s *ProductSnapshot) Scan(value any) error {
+	return jsonScan(value, s)
+}
+
+// FieldChange is the old and new JSON value of a changed field.
+type FieldChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// RevisionChanges maps JSON field names to their change.
+type RevisionChanges map[string]FieldChange
+
+func (c RevisionChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+	return jsonValue(c)
+}
+
+func (c *RevisionChanges) Scan(value any) error {
+	*c = nil
+	return jsonScan(value, c)
+}
+
+// ProductRevision is an append-only record of a change made to a product.
+type ProductRevision struct {
+	ID           uint            `gorm:"primaryKey" json:"id"`
+	ProductID    uint            `gorm:"not null;index" json:"product_id"`
+	OwnerID      uint            `gorm:"not null;index" json:"owner_id"`
+	ActorID      uint            `gorm:"not null" json:"actor_id"`
+	Action       string          `gorm:"not null" json:"action"`
+	Changes      RevisionChanges `gorm:"type:jsonb" json:"changes"`
+	Snapshot     ProductSnapshot `gorm:"type:jsonb" json:"snapshot"`
+	RevertedFrom *uint           `json:"reverted_from,omitempty"`
+	CreatedAt    time.Time       `gorm:"autoCreateTime" json:"created_at"`
+}
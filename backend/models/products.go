@@ -1,39 +1,196 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ProductStatusDraft            = "draft"
+	ProductStatusPublished        = "published"
+	ProductStatusArchived         = "archived"
+	ProductStatusOutOfStockHidden = "out_of_stock_hidden"
+)
+
+// IsValidProductStatus reports whether status is one of the known product states.
+func IsValidProductStatus(status string) bool {
+	switch status {
+	case ProductStatusDraft, ProductStatusPublished, ProductStatusArchived, ProductStatusOutOfStockHidden:
+		return true
+	}
+	return false
+}
 
 type Product struct {
 	ID           uint           `gorm:"primaryKey" json:"id"`
-	OwnerID      uint           `gorm:"not null;index" json:"owner_id"`
+	OwnerID      uint           `gorm:"not null;index;uniqueIndex:idx_products_owner_sku,priority:1,where:sku IS NOT NULL AND deleted_at IS NULL" json:"owner_id"`
 	CollectionID *uint          `gorm:"index" json:"collection_id"`
 	Name         string         `gorm:"not null" json:"name"`
 	Description  string         `gorm:"not null" json:"description"`
 	Price        float64        `gorm:"not null" json:"price"`
 	Sizes        string         `json:"sizes"`
+	Tags         string         `json:"tags"`
+	Stock        *int           `json:"stock"` // nil when stock isn't tracked
 	ImageURL     *string        `json:"image_url"`
 	Images       []ProductImage `gorm:"foreignKey:ProductID" json:"images"`
 
-	CreatedAt    time.Time      `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt    time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	Attributes []ProductAttributeValue `gorm:"foreignKey:ProductID" json:"attributes"`
+
+	// Catalogue attributes for shipping and inventory. SKU is unique per
+	// store and Barcode is a GTIN (EAN-8/UPC-A/EAN-13/GTIN-14).
+	SKU         *string  `gorm:"uniqueIndex:idx_products_owner_sku,priority:2" json:"sku"`
+	Barcode     *string  `gorm:"index" json:"barcode"`
+	WeightGrams *int     `json:"weight_grams"`
+	LengthCm    *float64 `json:"length_cm"`
+	WidthCm     *float64 `json:"width_cm"`
+	HeightCm    *float64 `json:"height_cm"`
+
+	// Only published products inside their publish window are public.
+	Status      string     `gorm:"not null;default:'published';index" json:"status"`
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
+
+	// Promotional pricing: CompareAtPrice is the "from" price shown struck
+	// through, SalePrice replaces Price while the sale window is open.
+	CompareAtPrice *float64   `json:"compare_at_price"`
+	SalePrice      *float64   `json:"sale_price"`
+	SaleStartsAt   *time.Time `json:"sale_starts_at"`
+	SaleEndsAt     *time.Time `json:"sale_ends_at"`
+
+	// Computed on read from the active sale and campaigns, never persisted.
+	CurrentPrice float64 `gorm:"-" json:"current_price"`
+	OnSale       bool    `gorm:"-" json:"on_sale"`
+
+	// Description is Markdown; DescriptionHTML is its sanitised rendering.
+	DescriptionHTML string `gorm:"-" json:"description_html"`
+
+	CreatedAt time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+func (p *Product) AfterFind(tx *gorm.DB) error {
+	p.DescriptionHTML = renderMarkdown(p.Description)
+	return nil
+}
+
+func (p *Product) AfterSave(tx *gorm.DB) error {
+	p.DescriptionHTML = renderMarkdown(p.Description)
+	return nil
+}
+
+// HideUnreadyImages drops the images that are still processing, or failed
+// to, and moves the main image to the first one left.
+func (p *Product) HideUnreadyImages() {
+	p.keepImages(func(image ProductImage) bool {
+		return image.Status == ProductImageReady
+	})
+}
+
+// HideUnwatermarkedImages drops the images not drawn with the watermark of
+// the given signature yet, so visitors never see them without it.
+func (p *Product) HideUnwatermarkedImages(signature string) {
+	p.keepImages(func(image ProductImage) bool {
+		return signature != "" && image.WatermarkSignature == signature
+	})
+}
+
+func (p *Product) keepImages(keep func(ProductImage) bool) {
+	kept := p.Images[:0]
+	for _, image := range p.Images {
+		if keep(image) {
+			kept = append(kept, image)
+		}
+	}
+	if len(kept) == len(p.Images) {
+		return
+	}
+	p.Images = kept
+	p.ImageURL = nil
+	if len(kept) > 0 {
+		p.ImageURL = &kept[0].ImageURL
+	}
+}
+
+// UseWatermarkedImages shows visitors the watermarked copies of the images,
+// main image included.
+func (p *Product) UseWatermarkedImages() {
+	for i := range p.Images {
+		original := p.Images[i].ImageURL
+		p.Images[i].UseWatermarked()
+		if p.ImageURL != nil && *p.ImageURL == original {
+			p.ImageURL = &p.Images[i].ImageURL
+		}
+	}
 }
 
 type CreateProductInput struct {
-	Name         string  `json:"name" form:"name" binding:"required"`
-	Description  string  `json:"description" form:"description"`
-	Price        float64 `json:"price" form:"price" binding:"required"`
-	Sizes        string  `json:"sizes" form:"sizes"`
+	Name        string  `json:"name" form:"name" binding:"required"`
+	Description string  `json:"description" form:"description"`
+	Price       float64 `json:"price" form:"price" binding:"required"`
+	Sizes       string  `json:"sizes" form:"sizes"`
+	Tags        string  `json:"tags" form:"tags"`
+	Stock       *int    `json:"stock" form:"stock"`
+
+	SKU         *string  `json:"sku" form:"sku"`
+	Barcode     *string  `json:"barcode" form:"barcode"`
+	WeightGrams *int     `json:"weight_grams" form:"weight_grams"`
+	LengthCm    *float64 `json:"length_cm" form:"length_cm"`
+	WidthCm     *float64 `json:"width_cm" form:"width_cm"`
+	HeightCm    *float64 `json:"height_cm" form:"height_cm"`
+
+	Status      string     `json:"status" form:"status"`
+	PublishAt   *time.Time `json:"publish_at" form:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at" form:"unpublish_at"`
+
+	CompareAtPrice *float64   `json:"compare_at_price" form:"compare_at_price"`
+	SalePrice      *float64   `json:"sale_price" form:"sale_price"`
+	SaleStartsAt   *time.Time `json:"sale_starts_at" form:"sale_starts_at"`
+	SaleEndsAt     *time.Time `json:"sale_ends_at" form:"sale_ends_at"`
+
+	// Attributes is a JSON object mapping attribute keys to values, sent as a
+	// string so it fits multipart forms.
+	Attributes string `json:"attributes" form:"attributes"`
 
 	CollectionID *uint   `json:"collection_id" form:"collection_id"`
 	ImageURL     *string `json:"image_url" form:"image_url"`
 }
 
 type UpdateProductInput struct {
-	Name            *string  `json:"name" form:"name"`
-	Description     *string  `json:"description" form:"description"`
-	Price           *float64 `json:"price" form:"price"`
-	Sizes           *string  `json:"sizes" form:"sizes"`
-
-	CollectionID    *uint    `json:"collection_id" form:"collection_id"`
-	ImageURL        *string  `json:"image_url" form:"image_url"`
-	DeleteImageIDs  []uint   `json:"delete_image_ids" form:"delete_image_ids"`
+	Name        *string  `json:"name" form:"name"`
+	Description *string  `json:"description" form:"description"`
+	Price       *float64 `json:"price" form:"price"`
+	Sizes       *string  `json:"sizes" form:"sizes"`
+	Tags        *string  `json:"tags" form:"tags"`
+	// A negative Stock stops tracking stock for the product.
+	Stock *int `json:"stock" form:"stock"`
+
+	// An empty SKU or Barcode, or a 0 weight or dimension, clears the field.
+	SKU         *string  `json:"sku" form:"sku"`
+	Barcode     *string  `json:"barcode" form:"barcode"`
+	WeightGrams *int     `json:"weight_grams" form:"weight_grams"`
+	LengthCm    *float64 `json:"length_cm" form:"length_cm"`
+	WidthCm     *float64 `json:"width_cm" form:"width_cm"`
+	HeightCm    *float64 `json:"height_cm" form:"height_cm"`
+
+	Status        *string    `json:"status" form:"status"`
+	PublishAt     *time.Time `json:"publish_at" form:"publish_at"`
+	UnpublishAt   *time.Time `json:"unpublish_at" form:"unpublish_at"`
+	ClearSchedule bool       `json:"clear_schedule" form:"clear_schedule"`
+
+	// A value of 0 for CompareAtPrice or SalePrice clears it; clearing the
+	// sale price also clears its schedule.
+	CompareAtPrice *float64   `json:"compare_at_price" form:"compare_at_price"`
+	SalePrice      *float64   `json:"sale_price" form:"sale_price"`
+	SaleStartsAt   *time.Time `json:"sale_starts_at" form:"sale_starts_at"`
+	SaleEndsAt     *time.Time `json:"sale_ends_at" form:"sale_ends_at"`
+
+	// Attributes only touches the keys it contains; a null or empty value
+	// removes the attribute from the product.
+	Attributes *string `json:"attributes" form:"attributes"`
+
+	CollectionID   *uint   `json:"collection_id" form:"collection_id"`
+	ImageURL       *string `json:"image_url" form:"image_url"`
+	DeleteImageIDs []uint  `json:"delete_image_ids" form:"delete_image_ids"`
 }
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// ShareLink is a named link to a collection, e.g. one per channel it is
+// shared on. Each link can be disabled, given an expiry or rotated to a new
+// token without affecting the others.
+type ShareLink struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	OwnerID      uint       `gorm:"not null;index" json:"owner_id"`
+	CollectionID uint       `gorm:"not null;index" json:"collection_id"`
+	Name         string     `gorm:"not null" json:"name"`
+	Token        string     `gorm:"not null;uniqueIndex" json:"token"`
+	IsActive     bool       `gorm:"not null;default:true" json:"is_active"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type CreateShareLinkInput struct {
+	Name      string     `json:"name" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// UpdateShareLinkInput changes a link. ClearExpiry removes its expiry, since
+// a null expires_at can't be told apart from a missing one.
+type UpdateShareLinkInput struct {
+	Name        *string    `json:"name"`
+	IsActive    *bool      `json:"is_active"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	ClearExpiry bool       `json:"clear_expiry"`
+}
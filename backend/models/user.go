@@ -3,14 +3,24 @@ package models
 import "time"
 
 type User struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Username  string    `gorm:"unique;not null" json:"username"`
-	Email     string    `gorm:"unique;not null" json:"email"`
-	Password  string    `gorm:"not null" json:"-"`
-	Number    string    `gorm:"unique;not null" json:"number"`
-	LogoURL   string    `json:"logo_url"`
-	PlanID    uint      `gorm:"not null;default:1" json:"plan_id"`
-	Plan      *Plan     `gorm:"foreignKey:PlanID" json:"plan,omitempty"`
+	ID            uint   `gorm:"primaryKey" json:"id"`
+	Username      string `gorm:"unique;not null" json:"username"`
+	Email         string `gorm:"unique;not null" json:"email"`
+	Password      string `gorm:"not null" json:"-"`
+	Number        string `gorm:"unique;not null" json:"number"`
+	LogoURL       string `json:"logo_url"`
+	LogoSizeBytes int64  `gorm:"not null;default:0" json:"-"`
+	PlanID        uint   `gorm:"not null;default:1" json:"plan_id"`
+	Plan          *Plan  `gorm:"foreignKey:PlanID" json:"plan,omitempty"`
+
+	// Public images are watermarked with the logo, or the store name when
+	// there's no logo. Opacity is a percentage.
+	WatermarkEnabled  bool   `gorm:"not null;default:false" json:"watermark_enabled"`
+	WatermarkPosition string `gorm:"not null;default:'bottom-right'" json:"watermark_position"`
+	WatermarkOpacity  int    `gorm:"not null;default:50" json:"watermark_opacity"`
+	// WatermarkSignature is the watermark SyncWatermarks last drew with;
+	// images not drawn with it yet are hidden from visitors.
+	WatermarkSignature string `gorm:"not null;default:''" json:"-"`
 
 	// Stripe subscription fields
 	StripeCustomerID     string     `json:"stripe_customer_id"`
@@ -20,5 +30,11 @@ type User struct {
 
 	ResetToken          string    `json:"-"`
 	ResetTokenExpiresAt time.Time `json:"-"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	CreatedAt           time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type UpdateWatermarkInput struct {
+	Enabled  *bool   `json:"enabled"`
+	Position *string `json:"position"`
+	Opacity  *int    `json:"opacity"`
 }
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 stores files in a bucket of any S3-compatible service (AWS S3, MinIO,
+// Cloudflare R2...), under a key prefix so the bucket can hold other data.
+type S3 struct {
+	client    *minio.Client
+	bucket    string
+	prefix    string
+	publicURL string
+}
+
+// defaultS3Prefix is where files are kept when S3_PREFIX isn't set.
+const defaultS3Prefix = "uploads/"
+
+// NewS3FromEnv configures the bucket from S3_ENDPOINT, S3_BUCKET,
+// S3_ACCESS_KEY, S3_SECRET_KEY, S3_REGION and S3_USE_SSL. Files are stored
+// under S3_PREFIX ("uploads/" by default). When S3_PUBLIC_URL is set (e.g. a
+// CDN or a public bucket URL) clients are sent there; otherwise the API
+// streams the files itself.
+func NewS3FromEnv() (*S3, error) {
+	endpoint := os.Getenv("S3_ENDPOINT")
+	bucket := os.Getenv("S3_BUCKET")
+	if endpoint == "" || bucket == "" {
+		return nil, errors.New("S3_ENDPOINT and S3_BUCKET are required")
+	}
+
+	prefix := defaultS3Prefix
+	if value := strings.Trim(os.Getenv("S3_PREFIX"), "/"); value != "" {
+		prefix = value + "/"
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"), ""),
+		Secure: os.Getenv("S3_USE_SSL") != "false",
+		Region: os.Getenv("S3_REGION"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(context.Background(), bucket)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach bucket %s: %w", bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("bucket %s does not exist", bucket)
+	}
+
+	return &S3{
+		client:    client,
+		bucket:    bucket,
+		prefix:    prefix,
+		publicURL: strings.TrimSuffix(os.Getenv("S3_PUBLIC_URL"), "/"),
+	}, nil
+}
+
+// object returns the name of the object holding key.
+func (s *S3) object(key string) (string, bool) {
+	key, ok := cleanKey(key)
+	if !ok {
+		return "", false
+	}
+	return s.prefix + key, true
+}
+
+func (s *S3) Put(key string, r io.Reader, size int64, contentType string) error {
+	object, ok := s.object(key)
+	if !ok {
+		return errors.New("invalid storage key")
+	}
+	_, err := s.client.PutObject(context.Background(), s.bucket, object, r, size, minio.PutObjectOptions{
+		ContentType:  contentType,
+		CacheControl: "public, max-age=31536000, immutable",
+	})
+	return err
+}
+
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	// GetObject is lazy; Stat surfaces a missing key before reading.
+	if _, err := s.Stat(key); err != nil {
+		return nil, err
+	}
+	object, _ := s.object(key)
+	return s.client.GetObject(context.Background(), s.bucket, object, minio.GetObjectOptions{})
+}
+
+func (s *S3) Stat(key string) (File, error) {
+	object, ok := s.object(key)
+	if !ok {
+		return File{}, errors.New("invalid storage key")
+	}
+	info, err := s.client.StatObject(context.Background(), s.bucket, object, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return File{}, ErrNotFound
+		}
+		return File{}, err
+	}
+	return File{Key: strings.TrimPrefix(object, s.prefix), Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+func (s *S3) Delete(key string) error {
+	object, ok := s.object(key)
+	if !ok {
+		return errors.New("invalid storage key")
+	}
+	return s.client.RemoveObject(context.Background(), s.bucket, object, minio.RemoveObjectOptions{})
+}
+
+func (s *S3) URL(key string) string {
+	object, ok := s.object(key)
+	if s.publicURL == "" || !ok {
+		return ""
+	}
+	return s.publicURL + "/" + object
+}
+
+func (s *S3) Walk(fn func(file File) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Only the prefix is listed: anything else in the bucket isn't ours.
+	options := minio.ListObjectsOptions{Prefix: s.prefix, Recursive: true}
+	for object := range s.client.ListObjects(ctx, s.bucket, options) {
+		if object.Err != nil {
+			return object.Err
+		}
+		key := strings.TrimPrefix(object.Key, s.prefix)
+		if err := fn(File{Key: key, Size: object.Size, ModTime: object.LastModified}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
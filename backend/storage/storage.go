@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Storage keeps uploaded files under slash-separated keys such as
+// "123_0.jpg" or "logos/logo_1_1700000000.jpg".
+type Storage interface {
+	Put(key string, r io.Reader, size int64, contentType string) error
+	// Get returns ErrNotFound when the key doesn't exist.
+	Get(key string) (io.ReadCloser, error)
+	// Stat returns ErrNotFound when the key doesn't exist.
+	Stat(key string) (File, error)
+	// Delete succeeds when the key doesn't exist.
+	Delete(key string) error
+	// URL is where clients can fetch the file directly, or "" when it has
+	// to be served through the API.
+	URL(key string) string
+	// Walk calls fn for every stored file.
+	Walk(fn func(file File) error) error
+}
+
+type File struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+var ErrNotFound = errors.New("file not found")
+
+// Store is the backend selected by ConnectStorage.
+var Store Storage
+
+// URLPrefix is the path uploads are served under. The database keeps
+// "/uploads/<key>" regardless of the backend, so files can move between
+// backends without rewriting records.
+const URLPrefix = "/uploads/"
+
+// ConnectStorage selects the backend from STORAGE_DRIVER: "local" (the
+// default, files under LOCAL_STORAGE_DIR or ./uploads) or "s3".
+func ConnectStorage() {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		dir := os.Getenv("LOCAL_STORAGE_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		Store = NewLocal(dir)
+	case "s3":
+		s3, err := NewS3FromEnv()
+		if err != nil {
+			log.Fatal("Failed to connect to object storage! ", err)
+		}
+		Store = s3
+	default:
+		log.Fatalf("Unknown STORAGE_DRIVER %q", driver)
+	}
+}
+
+// KeyFromURL returns the key of an "/uploads/..." URL, refusing paths that
+// try to escape the uploads namespace.
+func KeyFromURL(url string) (string, bool) {
+	rel, ok := strings.CutPrefix(url, URLPrefix)
+	if !ok {
+		return "", false
+	}
+	return cleanKey(rel)
+}
+
+// URLFromKey is the inverse of KeyFromURL.
+func URLFromKey(key string) string {
+	return URLPrefix + key
+}
+
+func cleanKey(key string) (string, bool) {
+	if key == "" || strings.Contains(key, "\\") {
+		return "", false
+	}
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != key {
+		return "", false
+	}
+	return cleaned, true
+}
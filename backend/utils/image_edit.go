@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
+)
+
+var ErrInvalidImageEdit = errors.New("invalid image edit")
+
+// ImageEdit lists the changes EditImage applies, in this order: crop, rotate
+// and pad to a square.
+type ImageEdit struct {
+	// Crop is in pixels of the stored image; nil keeps the whole image.
+	Crop *image.Rectangle
+	// Rotate is clockwise, in degrees: 0, 90, 180 or 270.
+	Rotate int
+	// PadSquare centers the image on a square filled with Background.
+	PadSquare  bool
+	Background color.RGBA
+}
+
+// rotateOrientations maps a clockwise rotation to the EXIF orientation
+// applyOrientation turns upright.
+var rotateOrientations = map[int]int{0: 1, 90: 6, 180: 3, 270: 8}
+
+// EditImage applies edit to the image behind imageURL and stores the result
+// as a new file, named after its content, returning its URL. The original
+// file is left alone since other images may use it.
+func EditImage(imageURL string, edit ImageEdit) (string, error) {
+	orientation, ok := rotateOrientations[edit.Rotate]
+	if !ok {
+		return "", fmt.Errorf("%w: rotation must be 0, 90, 180 or 270", ErrInvalidImageEdit)
+	}
+
+	key, ok := storage.KeyFromURL(imageURL)
+	if !ok {
+		return "", fmt.Errorf("invalid upload path")
+	}
+	data, err := readUpload(key)
+	if err != nil {
+		return "", err
+	}
+	img, err := DecodeImage(data)
+	if err != nil {
+		return "", err
+	}
+
+	if edit.Crop != nil {
+		bounds := img.Bounds()
+		crop := edit.Crop.Add(bounds.Min)
+		if crop.Empty() || !crop.In(bounds) {
+			return "", fmt.Errorf("%w: crop must be inside the %dx%d image", ErrInvalidImageEdit, bounds.Dx(), bounds.Dy())
+		}
+		cropped := image.NewRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+		draw.Draw(cropped, cropped.Rect, img, crop.Min, draw.Src)
+		img = cropped
+	}
+
+	img = applyOrientation(img, orientation)
+
+	if edit.PadSquare {
+		img = padSquare(img, edit.Background)
+	}
+
+	encoded, err := encodeImage(models.ImageFormatJPEG, img)
+	if err != nil {
+		return "", err
+	}
+	url, _, err := putEncoded(contentKey(encoded), models.ImageFormatJPEG, encoded)
+	return url, err
+}
+
+func padSquare(img image.Image, background color.RGBA) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() == bounds.Dy() {
+		return img
+	}
+	side := max(bounds.Dx(), bounds.Dy())
+	square := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Rect, image.NewUniform(background), image.Point{}, draw.Src)
+	offset := image.Pt((side-bounds.Dx())/2, (side-bounds.Dy())/2)
+	draw.Draw(square, bounds.Sub(bounds.Min).Add(offset), img, bounds.Min, draw.Over)
+	return square
+}
+
+// ParseHexColor parses an opaque "#rrggbb" or "#rgb" colour.
+func ParseHexColor(s string) (color.RGBA, error) {
+	digits := strings.TrimPrefix(s, "#")
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+	if len(digits) != 6 {
+		return color.RGBA{}, fmt.Errorf("%w: invalid colour %q", ErrInvalidImageEdit, s)
+	}
+	v, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("%w: invalid colour %q", ErrInvalidImageEdit, s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xFF}, nil
+}
@@ -1,37 +1,108 @@
 package utils
 
 import (
+	"bytes"
 	"image"
 	"image/jpeg"
-	_ "image/png"
+	"io"
 	"mime/multipart"
 	"os"
+	"strconv"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/config"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
+	"github.com/gen2brain/webp"
+	"golang.org/x/image/draw"
 )
 
-func SaveCompressedImage(fileHeader *multipart.FileHeader, destPath string) error {
+// SaveCompressedImage stores an uploaded image under key and returns its
+// URL. See SaveCompressedImageFromReader.
+func SaveCompressedImage(fileHeader *multipart.FileHeader, key string) (string, error) {
 	src, err := fileHeader.Open()
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer src.Close()
 
-	img, _, err := image.Decode(src)
+	return SaveCompressedImageFromReader(src, key)
+}
+
+// SaveCompressedImageFromReader decodes an image from r and stores it under
+// key as a compressed JPEG, returning its URL. The image is turned upright
+// according to its EXIF orientation and scaled down to MaxImageDimension;
+// re-encoding drops all metadata, including GPS location.
+func SaveCompressedImageFromReader(r io.Reader, key string) (string, error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
-		return err
+		return "", err
 	}
-	out, err := os.Create(destPath)
+	img, err := DecodeImage(data)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer out.Close()
 
-	return jpeg.Encode(out, img, &jpeg.Options{Quality: 75})
+	// Scale before rotating: the longest side is the same either way and
+	// rotating the smaller image is cheaper.
+	img = limitDimension(img, MaxImageDimension())
+	img = applyOrientation(img, jpegOrientation(data))
+
+	url, _, err := putImage(key, models.ImageFormatJPEG, img)
+	return url, err
+}
+
+// putImage encodes img in the given format and stores it under key,
+// returning its URL and size in bytes.
+func putImage(key, format string, img image.Image) (string, int64, error) {
+	data, err := encodeImage(format, img)
+	if err != nil {
+		return "", 0, err
+	}
+	return putEncoded(key, format, data)
 }
 
-func IsImageFile(fileHeader *multipart.FileHeader) bool {
-    contentType := fileHeader.Header.Get("Content-Type")
-    if contentType == "image/jpeg" || contentType == "image/png" || contentType == "image/jpg" {
-        return true
-    }
-    return false
+func encodeImage(format string, img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if format == models.ImageFormatWebP {
+		err = webp.Encode(&buf, img, webp.Options{Quality: config.JpegQuality})
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: config.JpegQuality})
+	}
+	return buf.Bytes(), err
+}
+
+func putEncoded(key, format string, data []byte) (string, int64, error) {
+	size := int64(len(data))
+	if err := storage.Store.Put(key, bytes.NewReader(data), size, "image/"+format); err != nil {
+		return "", 0, err
+	}
+	return storage.URLFromKey(key), size, nil
+}
+
+// MaxImageDimension is the longest side, in pixels, an uploaded image is
+// stored at. It can be overridden with MAX_IMAGE_DIMENSION.
+func MaxImageDimension() int {
+	if v, err := strconv.Atoi(os.Getenv("MAX_IMAGE_DIMENSION")); err == nil && v > 0 {
+		return v
+	}
+	return config.MaxImageDimension
+}
+
+func limitDimension(img image.Image, maxSide int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= maxSide && h <= maxSide {
+		return img
+	}
+	if w >= h {
+		h = max(1, h*maxSide/w)
+		w = maxSide
+	} else {
+		w = max(1, w*maxSide/h)
+		h = maxSide
+	}
+	resized := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+	return resized
 }
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/config"
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupportedImage   = errors.New("formato de imagem não suportado. Use JPEG, PNG ou WebP")
+	ErrImageTooManyPixels = errors.New("as dimensões da imagem excedem o limite permitido")
+)
+
+// SniffImageFormat identifies an image from its magic bytes, ignoring the
+// file name and the Content-Type sent by the client. It returns "" for
+// anything that isn't JPEG, PNG or WebP.
+func SniffImageFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return models.ImageFormatJPEG
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return models.ImageFormatWebP
+	}
+	return ""
+}
+
+// DecodeImage decodes an allowed image format. Dimensions are read from the
+// header first so decompression bombs are refused before any pixel memory
+// is allocated.
+func DecodeImage(data []byte) (image.Image, error) {
+	decode, err := checkImage(data)
+	if err != nil {
+		return nil, err
+	}
+	return decode(bytes.NewReader(data))
+}
+
+// CheckImage validates the format and dimensions of an image from its
+// header, without decoding the pixels.
+func CheckImage(data []byte) error {
+	_, err := checkImage(data)
+	return err
+}
+
+func checkImage(data []byte) (func(io.Reader) (image.Image, error), error) {
+	var decodeConfig func(io.Reader) (image.Config, error)
+	var decode func(io.Reader) (image.Image, error)
+	switch SniffImageFormat(data) {
+	case models.ImageFormatJPEG:
+		decodeConfig, decode = jpeg.DecodeConfig, jpeg.Decode
+	case "png":
+		decodeConfig, decode = png.DecodeConfig, png.Decode
+	case models.ImageFormatWebP:
+		decodeConfig, decode = webp.DecodeConfig, webp.Decode
+	default:
+		return nil, ErrUnsupportedImage
+	}
+
+	cfg, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > config.MaxImagePixels {
+		return nil, ErrImageTooManyPixels
+	}
+	return decode, nil
+}
+
+// IsImageFile reports whether an uploaded file's content is an allowed
+// image format.
+func IsImageFile(fileHeader *multipart.FileHeader) bool {
+	f, err := fileHeader.Open()
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 12)
+	n, _ := io.ReadFull(f, header)
+	return SniffImageFormat(header[:n]) != ""
+}
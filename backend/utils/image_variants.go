@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"path"
+	"strings"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
+	"golang.org/x/image/draw"
+)
+
+// imageVariantSizes are the widths generated for every upload. Images are
+// never upscaled, so small originals produce fewer sizes.
+var imageVariantSizes = []struct {
+	Name  string
+	Width int
+}{
+	{"thumb", 200},
+	{"card", 600},
+	{"full", 1600},
+}
+
+// GenerateImageVariants stores JPEG and WebP copies of an uploaded image at
+// each variant size next to the original, named "<base>_<size>.<ext>".
+func GenerateImageVariants(imageURL string) ([]models.ImageVariant, error) {
+	key, ok := storage.KeyFromURL(imageURL)
+	if !ok {
+		return nil, fmt.Errorf("invalid upload path")
+	}
+
+	data, err := readUpload(key)
+	if err != nil {
+		return nil, err
+	}
+	src, err := DecodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(key, path.Ext(key))
+	bounds := src.Bounds()
+
+	var variants []models.ImageVariant
+	lastWidth := 0
+	for _, size := range imageVariantSizes {
+		width := min(size.Width, bounds.Dx())
+		if width == lastWidth {
+			continue
+		}
+		lastWidth = width
+		height := max(1, bounds.Dy()*width/bounds.Dx())
+
+		resized := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(resized, resized.Bounds(), src, bounds, draw.Src, nil)
+
+		for _, format := range []string{models.ImageFormatJPEG, models.ImageFormatWebP} {
+			url, fileSize, err := putImage(fmt.Sprintf("%s_%s.%s", base, size.Name, variantExtension(format)), format, resized)
+			if err != nil {
+				RemoveImageVariants(variants)
+				return nil, err
+			}
+			variants = append(variants, models.ImageVariant{
+				Name:   size.Name,
+				Format: format,
+				Width:  width,
+				Height: height,
+				URL:    url,
+				Size:   fileSize,
+			})
+		}
+	}
+
+	return variants, nil
+}
+
+// RemoveImageVariants deletes the files of the given variants.
+func RemoveImageVariants(variants []models.ImageVariant) {
+	for _, variant := range variants {
+		RemoveUpload(variant.URL)
+	}
+}
+
+func variantExtension(format string) string {
+	if format == models.ImageFormatWebP {
+		return "webp"
+	}
+	return "jpg"
+}
@@ -1,93 +1,328 @@
 package utils
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
-	"os"
-	"path/filepath"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
 	"github.com/gin-gonic/gin"
 )
 
-// UploadImages handles uploading multiple images from a multipart form.
-// It tries to compress each image to JPEG; if that fails, saves the original.
-// Returns a list of URL paths for the uploaded images.
-func UploadImages(c *gin.Context, fieldName string, maxCount int, maxSize int64) ([]string, error) {
-	form, _ := c.MultipartForm()
-	var uploaded []string
+// ErrStorageQuotaExceeded is returned when an upload doesn't fit in the
+// storage left on the owner's plan.
+var ErrStorageQuotaExceeded = errors.New("limite de armazenamento do plano atingido")
 
-	if form != nil && form.File[fieldName] != nil {
-		files := form.File[fieldName]
-		if maxCount > 0 && len(files) > maxCount {
-			return nil, fmt.Errorf("máximo de %d imagens permitido", maxCount)
-		}
-		for i, file := range files {
-			url, err := saveOneImage(file, maxSize, i)
-			if err != nil {
-				return nil, err
-			}
-			uploaded = append(uploaded, url)
+// UploadImages handles uploading multiple images from a multipart form.
+// Files that aren't images are rejected; the others are stored as uploaded
+// and re-encoded as JPEG later by ProcessPendingImage, so the request doesn't
+// wait for it. maxCount limits the number of images and quotaBytes the bytes
+// stored, -1 meaning unlimited for both. Returns a list of URL paths for the
+// uploaded images.
+func UploadImages(c *gin.Context, fieldName string, maxCount int, maxSize int64, quotaBytes int64) ([]string, error) {
+	var files []*multipart.FileHeader
+	if form, _ := c.MultipartForm(); form != nil {
+		files = form.File[fieldName]
+	}
+	// Fallback: single "image" field
+	if len(files) == 0 {
+		if file, err := c.FormFile("image"); err == nil {
+			files = []*multipart.FileHeader{file}
 		}
 	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	if maxCount >= 0 && len(files) > maxCount {
+		return nil, fmt.Errorf("máximo de %d imagens permitido", maxCount)
+	}
+	if quotaBytes == 0 {
+		return nil, ErrStorageQuotaExceeded
+	}
+
+	// Files are named after their content, so another upload of the same
+	// photo may be using the ones stored here. Those left behind on failure
+	// are removed by the upload collector.
+	var uploaded []string
+	var stored int64
+	for _, file := range files {
+		url, size, err := saveOneImage(file, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		uploaded = append(uploaded, url)
 
-	// Fallback: try single "image" field if nothing uploaded yet
-	if len(uploaded) == 0 {
-		file, err := c.FormFile("image")
-		if err == nil {
-			url, err := saveOneImage(file, maxSize, 0)
-			if err != nil {
-				return nil, err
+		if quotaBytes > 0 {
+			stored += size
+			if stored > quotaBytes {
+				return nil, ErrStorageQuotaExceeded
 			}
-			uploaded = append(uploaded, url)
 		}
 	}
 
 	return uploaded, nil
 }
 
-// saveOneImage validates size, compresses to JPEG, and saves to disk.
-func saveOneImage(file *multipart.FileHeader, maxSize int64, index int) (string, error) {
+// saveOneImage validates size and stages the image.
+func saveOneImage(file *multipart.FileHeader, maxSize int64) (string, int64, error) {
 	if file.Size > maxSize {
-		return "", fmt.Errorf("o tamanho da imagem excede o limite de %dMB", maxSize/(1024*1024))
+		return "", 0, fmt.Errorf("o tamanho da imagem excede o limite de %dMB", maxSize/(1024*1024))
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid image")
+	}
+	defer src.Close()
+
+	return stageImage(src)
+}
+
+// pendingPrefix holds uploads waiting for ProcessPendingImage. They still
+// carry their metadata, such as GPS location, so they are never served.
+const pendingPrefix = "pending/"
+
+func pendingKey(key string) string {
+	return pendingPrefix + strings.TrimSuffix(key, path.Ext(key))
+}
+
+// IsPendingKey reports whether key is an upload waiting to be processed.
+func IsPendingKey(key string) bool {
+	return strings.HasPrefix(key, pendingPrefix)
+}
+
+// stageImage checks the header of an image and stores its bytes as
+// uploaded, returning the URL it will have once processed (see saveImage for
+// how it's named) and the bytes stored.
+func stageImage(r io.Reader) (url string, size int64, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid image")
 	}
 
-	baseFilename := fmt.Sprintf("%d_%d", time.Now().UnixNano(), index)
-	jpgFilename := baseFilename + ".jpg"
-	jpgPath := filepath.Join("uploads", jpgFilename)
+	key := contentKey(data)
+	url = storage.URLFromKey(key)
+	if file, err := storage.Store.Stat(key); err == nil {
+		return url, file.Size, nil
+	}
+	if file, err := storage.Store.Stat(pendingKey(key)); err == nil {
+		return url, file.Size, nil
+	}
 
-	if err := SaveCompressedImage(file, jpgPath); err == nil {
-		return "/uploads/" + jpgFilename, nil
+	if err := CheckImage(data); err != nil {
+		return "", 0, imageError(err)
+	}
+	if err := storage.Store.Put(pendingKey(key), bytes.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+		return "", 0, err
 	}
+	return url, int64(len(data)), nil
+}
 
-	// Fallback: save original format
-	ext := filepath.Ext(file.Filename)
-	filename := baseFilename + ext
-	path := filepath.Join("uploads", filename)
+// ProcessPendingImage re-encodes the pending upload of imageURL as JPEG
+// (see SaveCompressedImageFromReader) and deletes it. Nothing is done when
+// the image file already exists, e.g. processed for another image sharing it.
+func ProcessPendingImage(imageURL string) error {
+	key, ok := storage.KeyFromURL(imageURL)
+	if !ok {
+		return fmt.Errorf("invalid upload path")
+	}
+	if _, err := storage.Store.Stat(key); err != nil {
+		data, err := readUpload(pendingKey(key))
+		if err != nil {
+			return err
+		}
+		if _, err := SaveCompressedImageFromReader(bytes.NewReader(data), key); err != nil {
+			return imageError(err)
+		}
+	}
+	return storage.Store.Delete(pendingKey(key))
+}
 
-	src, err := file.Open()
+// PendingImageSize returns the size of the pending upload of imageURL.
+func PendingImageSize(imageURL string) (int64, error) {
+	key, ok := storage.KeyFromURL(imageURL)
+	if !ok {
+		return 0, fmt.Errorf("invalid upload path")
+	}
+	file, err := storage.Store.Stat(pendingKey(key))
 	if err != nil {
-		return "", fmt.Errorf("could not open image")
+		return 0, err
 	}
-	defer src.Close()
+	return file.Size, nil
+}
 
-	dst, err := os.Create(path)
+// SaveImageFromReader compresses an image read from r (e.g. a ZIP entry or a
+// downloaded file) to JPEG and stores it.
+func SaveImageFromReader(r io.Reader) (string, error) {
+	url, _, err := saveImage(r)
+	return url, err
+}
+
+// saveImage stores an image under the SHA-256 of its uploaded bytes, so the
+// same photo uploaded again, for another product or catalog, reuses the file
+// and its variants instead of storing a copy. created reports whether the
+// file is new.
+//
+// Only decodable images are kept: storing the original bytes would also keep
+// their metadata, such as GPS location.
+func saveImage(r io.Reader) (url string, created bool, err error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
-		return "", fmt.Errorf("could not save image")
+		return "", false, fmt.Errorf("invalid image")
 	}
-	defer dst.Close()
 
-	if _, err := dst.ReadFrom(src); err != nil {
-		return "", fmt.Errorf("could not save image")
+	key := contentKey(data)
+	if _, err := storage.Store.Stat(key); err == nil {
+		return storage.URLFromKey(key), false, nil
 	}
 
-	return "/uploads/" + filename, nil
+	url, err = SaveCompressedImageFromReader(bytes.NewReader(data), key)
+	if err != nil {
+		return "", false, imageError(err)
+	}
+	return url, true, nil
+}
+
+// imageError keeps the validation errors worth showing to the user and
+// hides decoder and storage details.
+func imageError(err error) error {
+	if errors.Is(err, ErrUnsupportedImage) || errors.Is(err, ErrImageTooManyPixels) {
+		return err
+	}
+	return fmt.Errorf("invalid image")
 }
 
-// CreateDirIfNotExists creates a directory and all parents if it doesn't exist.
-func CreateDirIfNotExists(dir string) error {
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		return os.MkdirAll(dir, 0755)
+// DownloadImage fetches a remote http(s) image and saves it like
+// SaveImageFromReader, refusing bodies larger than maxSize.
+func DownloadImage(rawURL string, maxSize int64) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", fmt.Errorf("invalid image URL")
+	}
+
+	resp, err := imageDownloadClient.Get(parsed.String())
+	if err != nil {
+		return "", fmt.Errorf("could not download image")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not download image: status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxSize {
+		return "", fmt.Errorf("image exceeds the %dMB limit", maxSize/(1024*1024))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return "", fmt.Errorf("could not download image")
+	}
+	if int64(len(data)) > maxSize {
+		return "", fmt.Errorf("image exceeds the %dMB limit", maxSize/(1024*1024))
+	}
+
+	return SaveImageFromReader(bytes.NewReader(data))
+}
+
+// maxImageRedirects caps the redirects followed when downloading an image.
+const maxImageRedirects = 5
+
+var errBlockedAddress = errors.New("image URL points to a non-public address")
+
+// imageDownloadClient downloads images from URLs given by sellers. It only
+// connects to public addresses, checked after DNS resolution and on every
+// redirect, so a URL can't reach the server's own network.
+var imageDownloadClient = &http.Client{
+	Timeout: 15 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: rejectNonPublicAddress,
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxImageRedirects {
+			return errors.New("too many redirects")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return errors.New("invalid redirect URL")
+		}
+		// Hostnames are checked by the dialer once resolved.
+		if ip := net.ParseIP(req.URL.Hostname()); ip != nil && !isPublicIP(ip) {
+			return errBlockedAddress
+		}
+		return nil
+	},
+}
+
+// rejectNonPublicAddress is a net.Dialer Control hook that refuses to
+// connect to loopback, private, link-local and unspecified addresses.
+func rejectNonPublicAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return errBlockedAddress
 	}
 	return nil
 }
+
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
+
+// contentKey names a stored JPEG after the SHA-256 of data.
+func contentKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) + ".jpg"
+}
+
+func readUpload(key string) ([]byte, error) {
+	f, err := storage.Store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// UploadSize returns the size in bytes of the file behind an "/uploads/..."
+// URL.
+func UploadSize(imageURL string) (int64, error) {
+	key, ok := storage.KeyFromURL(imageURL)
+	if !ok {
+		return 0, fmt.Errorf("invalid upload path")
+	}
+	file, err := storage.Store.Stat(key)
+	if err != nil {
+		return 0, err
+	}
+	return file.Size, nil
+}
+
+// RemoveUpload deletes the file behind an "/uploads/..." URL. Missing files
+// are not an error.
+func RemoveUpload(imageURL string) error {
+	key, ok := storage.KeyFromURL(imageURL)
+	if !ok {
+		return fmt.Errorf("invalid upload path")
+	}
+	return storage.Store.Delete(key)
+}
@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"path"
+	"slices"
+
+	"github.com/FelippeTN/Web-Catalogo/backend/models"
+	"github.com/FelippeTN/Web-Catalogo/backend/storage"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	WatermarkTopLeft     = "top-left"
+	WatermarkTopRight    = "top-right"
+	WatermarkBottomLeft  = "bottom-left"
+	WatermarkBottomRight = "bottom-right"
+	WatermarkCenter      = "center"
+)
+
+var WatermarkPositions = []string{
+	WatermarkTopLeft,
+	WatermarkTopRight,
+	WatermarkBottomLeft,
+	WatermarkBottomRight,
+	WatermarkCenter,
+}
+
+func IsValidWatermarkPosition(position string) bool {
+	return slices.Contains(WatermarkPositions, position)
+}
+
+// Watermark is the mark of a store drawn over its public images: its logo,
+// or its name when it has none.
+type Watermark struct {
+	LogoURL  string
+	Text     string
+	Position string
+	Opacity  int // percent
+
+	mark image.Image
+}
+
+// LoadWatermark prepares the mark of a store, falling back to text when the
+// logo can't be read.
+func LoadWatermark(logoURL, text, position string, opacity int) Watermark {
+	w := Watermark{Position: position, Opacity: min(max(opacity, 1), 100)}
+	if key, ok := storage.KeyFromURL(logoURL); ok {
+		if data, err := readUpload(key); err == nil {
+			if logo, err := DecodeImage(data); err == nil {
+				w.LogoURL = logoURL
+				w.mark = logo
+				return w
+			}
+		}
+	}
+	w.Text = text
+	w.mark = renderText(text)
+	return w
+}
+
+// Signature changes whenever the watermark looks different.
+func (w Watermark) Signature() string {
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s|%s|%s|%d", w.LogoURL, w.Text, w.Position, w.Opacity))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Apply returns a copy of img with the mark drawn over it, a quarter of the
+// image wide for a logo and a third for text.
+func (w Watermark) Apply(img image.Image) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Rect, img, bounds.Min, draw.Src)
+	if w.mark == nil {
+		return dst
+	}
+
+	markBounds := w.mark.Bounds()
+	width := dst.Rect.Dx() / 4
+	if w.LogoURL == "" {
+		width = dst.Rect.Dx() / 3
+	}
+	height := markBounds.Dy() * width / markBounds.Dx()
+	if width < 1 || height < 1 {
+		return dst
+	}
+
+	margin := min(dst.Rect.Dx(), dst.Rect.Dy()) / 30
+	var at image.Point
+	switch w.Position {
+	case WatermarkTopLeft:
+		at = image.Pt(margin, margin)
+	case WatermarkTopRight:
+		at = image.Pt(dst.Rect.Dx()-width-margin, margin)
+	case WatermarkBottomLeft:
+		at = image.Pt(margin, dst.Rect.Dy()-height-margin)
+	case WatermarkCenter:
+		at = image.Pt((dst.Rect.Dx()-width)/2, (dst.Rect.Dy()-height)/2)
+	default:
+		at = image.Pt(dst.Rect.Dx()-width-margin, dst.Rect.Dy()-height-margin)
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Rect, w.mark, markBounds, draw.Src, nil)
+	opacity := image.NewUniform(color.Alpha{A: uint8(w.Opacity * 255 / 100)})
+	draw.DrawMask(dst, scaled.Rect.Add(at), scaled, image.Point{}, opacity, image.Point{}, draw.Over)
+	return dst
+}
+
+// renderText draws text in white with a dark outline, so it shows on both
+// light and dark photos.
+func renderText(text string) image.Image {
+	face := basicfont.Face7x13
+	width := font.MeasureString(face, text).Ceil()
+	if width == 0 {
+		return nil
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width+2, face.Height+2))
+	drawer := &font.Drawer{Dst: img, Face: face}
+	for _, offset := range []image.Point{{0, 1}, {2, 1}, {1, 0}, {1, 2}} {
+		drawer.Src = image.NewUniform(color.RGBA{A: 0xC0})
+		drawer.Dot = fixed.P(offset.X, face.Ascent+offset.Y)
+		drawer.DrawString(text)
+	}
+	drawer.Src = image.White
+	drawer.Dot = fixed.P(1, face.Ascent+1)
+	drawer.DrawString(text)
+	return img
+}
+
+// GenerateWatermarkedVariants stores watermarked copies of the variants of
+// an image, or of the image itself when it has none. The originals are left
+// untouched. Copies are named after their own content, so their URLs don't
+// lead visitors to the originals. Images of a store sharing a file share its
+// watermarked copies too, so files written before a failure are left to the
+// upload collector.
+func GenerateWatermarkedVariants(imageURL string, variants []models.ImageVariant, w Watermark) ([]models.ImageVariant, error) {
+	sources := variants
+	if len(sources) == 0 {
+		sources = []models.ImageVariant{{Name: "full", Format: models.ImageFormatJPEG, URL: imageURL}}
+	}
+
+	var marked []models.ImageVariant
+	for _, source := range sources {
+		key, ok := storage.KeyFromURL(source.URL)
+		if !ok {
+			return nil, fmt.Errorf("invalid upload path")
+		}
+		data, err := readUpload(key)
+		if err != nil {
+			return nil, err
+		}
+		img, err := DecodeImage(data)
+		if err != nil {
+			return nil, err
+		}
+
+		encoded, err := encodeImage(source.Format, w.Apply(img))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(encoded)
+		markedKey := hex.EncodeToString(sum[:]) + path.Ext(key)
+		url, size, err := putEncoded(markedKey, source.Format, encoded)
+		if err != nil {
+			return nil, err
+		}
+		variant := source
+		variant.Width, variant.Height = img.Bounds().Dx(), img.Bounds().Dy()
+		variant.URL = url
+		variant.Size = size
+		marked = append(marked, variant)
+	}
+	return marked, nil
+}
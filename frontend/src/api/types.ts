@@ -1,7 +1,6 @@
 export type Collection = {
   id: number
   owner_id: number
-  share_token?: string | null
   name: string
   description: string
   created_at: string